@@ -5,6 +5,8 @@ package ast // import "github.com/pto/monkey/ast"
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/pto/monkey/token"
 )
@@ -13,6 +15,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of first character belonging to the node
+	End() token.Position // position of first character immediately after the node
 }
 
 // Statement is a Node for statements.
@@ -24,12 +28,13 @@ type Statement interface {
 // Expression is a Node for expressions.
 type Expression interface {
 	Node
-	expressionNode() // type market only
+	expressionNode() // type marker only
 }
 
 // Program is a Node that represents an entire program.
 type Program struct {
 	Statements []Statement
+	Comments   []*CommentGroup // all comments in the source, in order
 }
 
 // TokenLiteral returns the first statement in a program, for debugging.
@@ -51,11 +56,29 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// Pos returns the position of the first statement in the Program.
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// End returns the end position of the last statement in the Program.
+func (p *Program) End() token.Position {
+	if n := len(p.Statements); n > 0 {
+		return p.Statements[n-1].End()
+	}
+	return token.Position{}
+}
+
 // LetStatement is a Node representing a let statement.
 type LetStatement struct {
-	Token token.Token // always a LET
-	Name  *Identifier
-	Value Expression
+	Doc     *CommentGroup // comments on the lines before; or nil
+	Token   token.Token   // always a LET
+	Name    *Identifier
+	Value   Expression
+	Comment *CommentGroup // comments after the statement on its line; or nil
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -80,6 +103,22 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Pos returns the position of the "let" keyword.
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+// End returns the end position of the bound value.
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
+
 // Identifier is a Node representing an identifier.
 type Identifier struct {
 	Token token.Token // always IDENT
@@ -98,10 +137,22 @@ func (i *Identifier) String() string {
 	return i.Value
 }
 
+// Pos returns the position of the Identifier.
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+// End returns the end position of the Identifier.
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
+
 // ReturnStatement is a Node representing a return statement.
 type ReturnStatement struct {
-	Token       token.Token // always a RETURN
+	Doc         *CommentGroup // comments on the lines before; or nil
+	Token       token.Token   // always a RETURN
 	ReturnValue Expression
+	Comment     *CommentGroup // comments after the statement on its line; or nil
 }
 
 func (rs *ReturnStatement) statementNode() {}
@@ -124,10 +175,25 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// Pos returns the position of the "return" keyword.
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
+// End returns the end position of the returned value.
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
+
 // ExpressionStatement is a Node representing an expression statement.
 type ExpressionStatement struct {
-	Token      token.Token // the first token only
+	Doc        *CommentGroup // comments on the lines before; or nil
+	Token      token.Token   // the first token only
 	Expression Expression
+	Comment    *CommentGroup // comments after the statement on its line; or nil
 }
 
 func (es *ExpressionStatement) statementNode() {}
@@ -145,6 +211,19 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+// Pos returns the position of the first token of the ExpressionStatement.
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+// End returns the end position of the expression.
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
+
 // IntegerLiteral is a Node representing an integer literal.
 type IntegerLiteral struct {
 	Token token.Token
@@ -163,6 +242,69 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// Pos returns the position of the IntegerLiteral.
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+// End returns the end position of the IntegerLiteral.
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
+
+// StringLiteral is a Node representing a string literal.
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode() {}
+
+// TokenLiteral for a string literal returns the value of the string.
+func (sl *StringLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+
+// String returns the StringLiteral as a quoted, escaped Monkey string.
+func (sl *StringLiteral) String() string {
+	return Quote(sl.Value)
+}
+
+// Pos returns the position of the opening quote.
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
+// End returns the position immediately after the closing quote.
+func (sl *StringLiteral) End() token.Position {
+	return sl.Token.End
+}
+
+// Quote returns a double-quoted Monkey string literal representing s.
+func Quote(s string) string {
+	var out bytes.Buffer
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case unicode.IsPrint(r):
+			out.WriteRune(r)
+		default:
+			fmt.Fprintf(&out, `\u{%x}`, r)
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
+
 // PrefixExpression is a Node representing a prefix expression.
 type PrefixExpression struct {
 	Token    token.Token
@@ -187,6 +329,19 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// Pos returns the position of the operator.
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+// End returns the end position of the operand.
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
+
 // InfixExpression is a Node representing an infix expression.
 type InfixExpression struct {
 	Token    token.Token
@@ -207,3 +362,463 @@ func (oe *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", oe.Left.String(), oe.Operator,
 		oe.Right.String())
 }
+
+// Pos returns the position of the left operand.
+func (oe *InfixExpression) Pos() token.Position {
+	if oe.Left != nil {
+		return oe.Left.Pos()
+	}
+	return oe.Token.Pos
+}
+
+// End returns the end position of the right operand.
+func (oe *InfixExpression) End() token.Position {
+	if oe.Right != nil {
+		return oe.Right.End()
+	}
+	return oe.Token.End
+}
+
+// Boolean is a Node representing a boolean literal.
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) expressionNode() {}
+
+// TokenLiteral for a boolean returns "true" or "false".
+func (b *Boolean) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// String returns a description of the Boolean.
+func (b *Boolean) String() string {
+	return b.Token.Literal
+}
+
+// Pos returns the position of the Boolean.
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+// End returns the end position of the Boolean.
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
+
+// IfExpression is a Node representing an if expression with an optional
+// else clause.
+type IfExpression struct {
+	Token       token.Token // always an IF
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode() {}
+
+// TokenLiteral for an if expression always returns "if".
+func (ie *IfExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+
+// String returns a description of the IfExpression.
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// Pos returns the position of the "if" keyword.
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+// End returns the end position of the last block.
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
+
+// BlockStatement is a Node representing a braced sequence of statements.
+type BlockStatement struct {
+	Token      token.Token // always a LBRACE
+	Statements []Statement
+	Rbrace     token.Position // position of the closing "}"
+}
+
+func (bs *BlockStatement) statementNode() {}
+
+// TokenLiteral for a block statement always returns "{".
+func (bs *BlockStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+// String returns a description of the BlockStatement.
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+
+	return out.String()
+}
+
+// Pos returns the position of the opening brace.
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+// End returns the position immediately after the closing brace.
+func (bs *BlockStatement) End() token.Position {
+	if !bs.Rbrace.IsValid() {
+		return bs.Token.End
+	}
+	return after(bs.Rbrace)
+}
+
+// FunctionLiteral is a Node representing a function literal.
+type FunctionLiteral struct {
+	Token      token.Token // always a FUNCTION
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode() {}
+
+// TokenLiteral for a function literal always returns "fn".
+func (fl *FunctionLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+// String returns a description of the FunctionLiteral.
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+// Pos returns the position of the "fn" keyword.
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+// End returns the end position of the function body.
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
+
+// MacroLiteral is a Node representing a macro literal.
+type MacroLiteral struct {
+	Token      token.Token // always a MACRO
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+
+// TokenLiteral for a macro literal always returns "macro".
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+
+// String returns a description of the MacroLiteral.
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// Pos returns the position of the "macro" keyword.
+func (ml *MacroLiteral) Pos() token.Position {
+	return ml.Token.Pos
+}
+
+// End returns the end position of the macro body.
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End
+}
+
+// CallExpression is a Node representing a function call.
+type CallExpression struct {
+	Token     token.Token // always a LPAREN
+	Function  Expression  // Identifier or FunctionLiteral
+	Arguments []Expression
+	Rparen    token.Position // position of the closing ")"
+}
+
+func (ce *CallExpression) expressionNode() {}
+
+// TokenLiteral for a call expression always returns "(".
+func (ce *CallExpression) TokenLiteral() string {
+	return ce.Token.Literal
+}
+
+// String returns a description of the CallExpression.
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// Pos returns the position of the called function.
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+
+// End returns the position immediately after the closing parenthesis.
+func (ce *CallExpression) End() token.Position {
+	if !ce.Rparen.IsValid() {
+		return ce.Token.End
+	}
+	return after(ce.Rparen)
+}
+
+// ArrayLiteral is a Node representing an array literal.
+type ArrayLiteral struct {
+	Token    token.Token // always a LBRACKET
+	Elements []Expression
+	Rbrack   token.Position // position of the closing "]"
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+
+// TokenLiteral for an array literal always returns "[".
+func (al *ArrayLiteral) TokenLiteral() string {
+	return al.Token.Literal
+}
+
+// String returns a description of the ArrayLiteral.
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Pos returns the position of the opening bracket.
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
+// End returns the position immediately after the closing bracket.
+func (al *ArrayLiteral) End() token.Position {
+	if !al.Rbrack.IsValid() {
+		return al.Token.End
+	}
+	return after(al.Rbrack)
+}
+
+// IndexExpression is a Node representing an index expression.
+type IndexExpression struct {
+	Token  token.Token // always a LBRACKET
+	Left   Expression
+	Index  Expression
+	Rbrack token.Position // position of the closing "]"
+}
+
+func (ie *IndexExpression) expressionNode() {}
+
+// TokenLiteral for an index expression always returns "[".
+func (ie *IndexExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+
+// String returns a description of the IndexExpression.
+func (ie *IndexExpression) String() string {
+	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
+}
+
+// Pos returns the position of the indexed expression.
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+// End returns the position immediately after the closing bracket.
+func (ie *IndexExpression) End() token.Position {
+	if !ie.Rbrack.IsValid() {
+		return ie.Token.End
+	}
+	return after(ie.Rbrack)
+}
+
+// HashLiteral is a Node representing a hash literal.
+type HashLiteral struct {
+	Token  token.Token    // always a LBRACE
+	Pairs  []HashPair     // in source order
+	Rbrace token.Position // position of the closing "}"
+}
+
+// HashPair is a key and value in a HashLiteral.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode() {}
+
+// TokenLiteral for a hash literal always returns "{".
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+
+// String returns a description of the HashLiteral.
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Pos returns the position of the opening brace.
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
+// End returns the position immediately after the closing brace.
+func (hl *HashLiteral) End() token.Position {
+	if !hl.Rbrace.IsValid() {
+		return hl.Token.End
+	}
+	return after(hl.Rbrace)
+}
+
+// after returns the position immediately after the single-character token at
+// pos.
+func after(pos token.Position) token.Position {
+	pos.Offset++
+	pos.Column++
+	return pos
+}
+
+// BadStatement is a placeholder for a statement containing syntax errors for
+// which no correct statement node can be created.
+type BadStatement struct {
+	From, To token.Position // position range of the bad statement
+}
+
+func (bs *BadStatement) statementNode() {}
+
+// TokenLiteral for a bad statement always returns "".
+func (bs *BadStatement) TokenLiteral() string {
+	return ""
+}
+
+// String returns a description of the BadStatement.
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+// Pos returns the start of the BadStatement.
+func (bs *BadStatement) Pos() token.Position {
+	return bs.From
+}
+
+// End returns the end of the BadStatement.
+func (bs *BadStatement) End() token.Position {
+	return bs.To
+}
+
+// BadExpression is a placeholder for an expression containing syntax errors
+// for which no correct expression node can be created.
+type BadExpression struct {
+	From, To token.Position // position range of the bad expression
+}
+
+func (be *BadExpression) expressionNode() {}
+
+// TokenLiteral for a bad expression always returns "".
+func (be *BadExpression) TokenLiteral() string {
+	return ""
+}
+
+// String returns a description of the BadExpression.
+func (be *BadExpression) String() string {
+	return "<bad expression>"
+}
+
+// Pos returns the start of the BadExpression.
+func (be *BadExpression) Pos() token.Position {
+	return be.From
+}
+
+// End returns the end of the BadExpression.
+func (be *BadExpression) End() token.Position {
+	return be.To
+}
@@ -0,0 +1,124 @@
+package ast // import "github.com/pto/monkey/ast"
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pto/monkey/token"
+)
+
+// Comment is a Node representing a single "//" or "/* */" comment.
+type Comment struct {
+	Slash token.Position // position of the "/" starting the comment
+	Text  string         // comment text, without the end of a line comment
+}
+
+// TokenLiteral for a comment returns its text.
+func (c *Comment) TokenLiteral() string {
+	return c.Text
+}
+
+// String returns the text of the Comment.
+func (c *Comment) String() string {
+	return c.Text
+}
+
+// Pos returns the position of the slash starting the Comment.
+func (c *Comment) Pos() token.Position {
+	return c.Slash
+}
+
+// End returns the position immediately after the Comment.
+func (c *Comment) End() token.Position {
+	if !c.Slash.IsValid() {
+		return c.Slash
+	}
+	end := c.Slash
+	end.Offset += len(c.Text)
+	if i := strings.LastIndexByte(c.Text, '\n'); i >= 0 {
+		end.Line += strings.Count(c.Text, "\n")
+		end.Column = utf8.RuneCountInString(c.Text[i:])
+	} else {
+		end.Column += utf8.RuneCountInString(c.Text)
+	}
+	return end
+}
+
+// CommentGroup is a Node representing a sequence of comments with no other
+// tokens and no blank lines between them.
+type CommentGroup struct {
+	List []*Comment // len(List) > 0
+}
+
+// TokenLiteral for a comment group returns the text of its first comment.
+func (g *CommentGroup) TokenLiteral() string {
+	if len(g.List) > 0 {
+		return g.List[0].Text
+	}
+	return ""
+}
+
+// String returns the text of the comments in the CommentGroup, one per line.
+func (g *CommentGroup) String() string {
+	texts := []string{}
+	for _, c := range g.List {
+		texts = append(texts, c.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Pos returns the position of the first comment in the CommentGroup.
+func (g *CommentGroup) Pos() token.Position {
+	if len(g.List) > 0 {
+		return g.List[0].Pos()
+	}
+	return token.Position{}
+}
+
+// End returns the end position of the last comment in the CommentGroup.
+func (g *CommentGroup) End() token.Position {
+	if n := len(g.List); n > 0 {
+		return g.List[n-1].End()
+	}
+	return token.Position{}
+}
+
+// Text returns the text of the comments in the CommentGroup without the
+// comment markers. A space after "//" or "/*" is removed, as are trailing spaces
+// on each line and blank lines at the start and end. Runs of blank lines
+// are reduced to one. Unless it is empty, the result ends in a newline. A nil
+// CommentGroup has the empty text.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+
+	var lines []string
+	for _, c := range g.List {
+		text := c.Text
+		if strings.HasPrefix(text, "//") {
+			text = text[2:]
+		} else {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		}
+		text = strings.TrimPrefix(text, " ")
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+
+	var out []string
+	for _, line := range lines {
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
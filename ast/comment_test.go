@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/pto/monkey/token"
+)
+
+func TestCommentGroupText(t *testing.T) {
+	tests := []struct {
+		comments []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"//"}, ""},
+		{[]string{"// one"}, "one\n"},
+		{[]string{"//one  ", "//  two"}, "one\n two\n"},
+		{[]string{"// a", "//", "//", "// b", "//"}, "a\n\nb\n"},
+		{[]string{"/* block */"}, "block\n"},
+		{[]string{"/*\n  indented\n\n\n  lines\n*/"}, "  indented\n\n  lines\n"},
+		{[]string{"/* a */", "// b"}, "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		g := &CommentGroup{}
+		for _, text := range tt.comments {
+			g.List = append(g.List, &Comment{Text: text})
+		}
+		if got := g.Text(); got != tt.expected {
+			t.Errorf("Text() of %q is %q, want %q", tt.comments, got,
+				tt.expected)
+		}
+	}
+
+	var nilGroup *CommentGroup
+	if got := nilGroup.Text(); got != "" {
+		t.Errorf("Text() of nil group is %q, want \"\"", got)
+	}
+}
+
+func TestCommentEnd(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"// abc", "2:9"},
+		{"/* a\nbc */", "3:6"},
+		{"// café", "2:10"},
+		{"/* é\nçé */", "3:6"},
+	}
+
+	for _, tt := range tests {
+		c := &Comment{Slash: token.Position{Offset: 5, Line: 2, Column: 3},
+			Text: tt.text}
+		end := c.End()
+		if end.String() != tt.expected || end.Offset != 5+len(tt.text) {
+			t.Errorf("End() of %q is %s (offset %d), want %s (offset %d)",
+				tt.text, end, end.Offset, tt.expected, 5+len(tt.text))
+		}
+	}
+}
@@ -0,0 +1,720 @@
+package ast // import "github.com/pto/monkey/ast"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/pto/monkey/token"
+)
+
+// MarshalJSON returns the JSON encoding of the tree rooted at node. Each Node
+// becomes an object whose "type" member is the name of its Go type, followed
+// by its "pos" and "end" positions, the positions of any other tokens, and
+// its fields in source order, as in
+//
+//	{"type":"InfixExpression","pos":{...},"end":{...},"operatorPos":{...},
+//	 "operator":"+","left":{...},"right":{...}}
+//
+// Positions are objects with "offset", "line" and "column" members, and a
+// "filename" member if it is not empty. Invalid positions are left out, and
+// missing child nodes are null. The "doc" and "comment" members of
+// statements are left out if there are no such comments.
+func MarshalJSON(node Node) ([]byte, error) {
+	var e encoder
+	obj := e.node(node)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON returns the tree encoded in data by MarshalJSON.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var d decoder
+	node := d.node(data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+// jsonObject is a JSON object that keeps its members in order.
+type jsonObject []jsonMember
+
+// jsonMember is a member of a jsonObject.
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the members of the object in order.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Quote(m.key))
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// add appends a member to o.
+func (o *jsonObject) add(key string, value interface{}) {
+	*o = append(*o, jsonMember{key, value})
+}
+
+// addPos appends a position member to o, if pos is valid.
+func (o *jsonObject) addPos(key string, pos token.Position) {
+	if pos.IsValid() {
+		o.add(key, jsonPosition(pos))
+	}
+}
+
+// jsonPosition is the JSON encoding of a token.Position.
+type jsonPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// encoder converts Nodes to jsonObjects. It records the first error.
+type encoder struct {
+	err error
+}
+
+// node returns the JSON form of node.
+func (e *encoder) node(node Node) jsonObject {
+	obj := jsonObject{}
+	obj.add("type", nodeTypeName(node))
+	obj.addPos("pos", node.Pos())
+	obj.addPos("end", node.End())
+
+	switch n := node.(type) {
+	case *Comment:
+		obj.add("text", n.Text)
+	case *CommentGroup:
+		list := []jsonObject{}
+		for _, c := range n.List {
+			list = append(list, e.node(c))
+		}
+		obj.add("list", list)
+	case *Program:
+		obj.add("statements", e.statements(n.Statements))
+		groups := []jsonObject{}
+		for _, g := range n.Comments {
+			groups = append(groups, e.node(g))
+		}
+		obj.add("comments", groups)
+	case *LetStatement:
+		e.doc(&obj, n.Doc)
+		obj.add("name", e.identifier(n.Name))
+		obj.add("value", e.expression(n.Value))
+		e.comment(&obj, n.Comment)
+	case *ReturnStatement:
+		e.doc(&obj, n.Doc)
+		obj.add("value", e.expression(n.ReturnValue))
+		e.comment(&obj, n.Comment)
+	case *ExpressionStatement:
+		e.doc(&obj, n.Doc)
+		obj.add("literal", n.Token.Literal)
+		obj.add("expression", e.expression(n.Expression))
+		e.comment(&obj, n.Comment)
+	case *BlockStatement:
+		obj.addPos("rbrace", n.Rbrace)
+		obj.add("statements", e.statements(n.Statements))
+	case *Identifier:
+		obj.add("value", n.Value)
+	case *IntegerLiteral:
+		obj.add("literal", n.Token.Literal)
+		obj.add("value", n.Value)
+	case *StringLiteral:
+		obj.add("value", n.Value)
+	case *Boolean:
+		obj.add("value", n.Value)
+	case *PrefixExpression:
+		obj.add("operator", n.Operator)
+		obj.add("right", e.expression(n.Right))
+	case *InfixExpression:
+		obj.addPos("operatorPos", n.Token.Pos)
+		obj.add("operator", n.Operator)
+		obj.add("left", e.expression(n.Left))
+		obj.add("right", e.expression(n.Right))
+	case *IfExpression:
+		obj.add("condition", e.expression(n.Condition))
+		obj.add("consequence", e.block(n.Consequence))
+		obj.add("alternative", e.block(n.Alternative))
+	case *FunctionLiteral:
+		obj.add("parameters", e.identifiers(n.Parameters))
+		obj.add("body", e.block(n.Body))
+	case *MacroLiteral:
+		obj.add("parameters", e.identifiers(n.Parameters))
+		obj.add("body", e.block(n.Body))
+	case *CallExpression:
+		obj.addPos("lparen", n.Token.Pos)
+		obj.addPos("rparen", n.Rparen)
+		obj.add("function", e.expression(n.Function))
+		obj.add("arguments", e.expressions(n.Arguments))
+	case *ArrayLiteral:
+		obj.addPos("rbrack", n.Rbrack)
+		obj.add("elements", e.expressions(n.Elements))
+	case *IndexExpression:
+		obj.addPos("lbrack", n.Token.Pos)
+		obj.addPos("rbrack", n.Rbrack)
+		obj.add("left", e.expression(n.Left))
+		obj.add("index", e.expression(n.Index))
+	case *HashLiteral:
+		obj.addPos("rbrace", n.Rbrace)
+		pairs := []jsonObject{}
+		for _, pair := range n.Pairs {
+			pairs = append(pairs, jsonObject{
+				{"key", e.expression(pair.Key)},
+				{"value", e.expression(pair.Value)},
+			})
+		}
+		obj.add("pairs", pairs)
+	case *BadStatement, *BadExpression:
+		// only positions
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("ast.MarshalJSON: unexpected node type %T", n)
+		}
+	}
+
+	return obj
+}
+
+// doc adds the leading comments of a statement to obj, if there are any.
+func (e *encoder) doc(obj *jsonObject, g *CommentGroup) {
+	if g != nil {
+		obj.add("doc", e.node(g))
+	}
+}
+
+// comment adds the trailing comments of a statement to obj, if there are
+// any.
+func (e *encoder) comment(obj *jsonObject, g *CommentGroup) {
+	if g != nil {
+		obj.add("comment", e.node(g))
+	}
+}
+
+// expression returns the JSON form of an Expression field, which may be nil.
+func (e *encoder) expression(expr Expression) interface{} {
+	if expr == nil {
+		return nil
+	}
+	return e.node(expr)
+}
+
+// identifier returns the JSON form of an Identifier field, which may be nil.
+func (e *encoder) identifier(ident *Identifier) interface{} {
+	if ident == nil {
+		return nil
+	}
+	return e.node(ident)
+}
+
+// block returns the JSON form of a BlockStatement field, which may be nil.
+func (e *encoder) block(block *BlockStatement) interface{} {
+	if block == nil {
+		return nil
+	}
+	return e.node(block)
+}
+
+// statements returns the JSON form of a list of Statements.
+func (e *encoder) statements(list []Statement) []interface{} {
+	out := []interface{}{}
+	for _, s := range list {
+		if s == nil {
+			out = append(out, nil)
+		} else {
+			out = append(out, e.node(s))
+		}
+	}
+	return out
+}
+
+// expressions returns the JSON form of a list of Expressions.
+func (e *encoder) expressions(list []Expression) []interface{} {
+	out := []interface{}{}
+	for _, expr := range list {
+		out = append(out, e.expression(expr))
+	}
+	return out
+}
+
+// identifiers returns the JSON form of a list of Identifiers.
+func (e *encoder) identifiers(list []*Identifier) []interface{} {
+	out := []interface{}{}
+	for _, ident := range list {
+		out = append(out, e.identifier(ident))
+	}
+	return out
+}
+
+// nodeTypeName returns the name of the type of node, without the package.
+func nodeTypeName(node Node) string {
+	name := fmt.Sprintf("%T", node)
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '.' {
+			return name[i+1:]
+		}
+	}
+	return name
+}
+
+// decoder converts JSON back to Nodes. It records the first error, after
+// which it returns nil Nodes. Only the children that the parser may leave
+// out can be null; the others are required, since String depends on them.
+type decoder struct {
+	err    error
+	groups map[token.Position]*CommentGroup // comment groups of the Program
+}
+
+// errorf records an error.
+func (d *decoder) errorf(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast.UnmarshalJSON: "+format, a...)
+	}
+}
+
+// members unmarshals a JSON object, returning nil for JSON null.
+func (d *decoder) members(data json.RawMessage) map[string]json.RawMessage {
+	if d.err != nil {
+		return nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		d.errorf("%s", err)
+		return nil
+	}
+	return m
+}
+
+// value unmarshals the member key of m into v.
+func (d *decoder) value(m map[string]json.RawMessage, key string, v interface{}) {
+	if d.err != nil {
+		return
+	}
+	raw, ok := m[key]
+	if !ok {
+		d.errorf("%s is missing %q", typeOf(m), key)
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		d.errorf("%s.%s: %s", typeOf(m), key, err)
+	}
+}
+
+// pos returns the position in member key of m, or the zero Position if
+// there is none.
+func (d *decoder) pos(m map[string]json.RawMessage, key string) token.Position {
+	raw, ok := m[key]
+	if !ok || d.err != nil {
+		return token.Position{}
+	}
+	var p jsonPosition
+	if err := json.Unmarshal(raw, &p); err != nil {
+		d.errorf("%s.%s: %s", typeOf(m), key, err)
+	}
+	return token.Position(p)
+}
+
+// typeOf returns the type member of m, for error messages.
+func typeOf(m map[string]json.RawMessage) string {
+	var name string
+	json.Unmarshal(m["type"], &name)
+	return name
+}
+
+// keyword returns a token with the given type and literal at pos.
+func keyword(typ token.Type, literal string, pos token.Position) token.Token {
+	tok := token.Token{Type: typ, Literal: literal, Pos: pos}
+	if pos.IsValid() {
+		tok.End = pos
+		tok.End.Offset += len(literal)
+		tok.End.Column += len(literal)
+	}
+	return tok
+}
+
+// node decodes a Node, returning nil for JSON null.
+func (d *decoder) node(data json.RawMessage) Node {
+	m := d.members(data)
+	if m == nil {
+		return nil
+	}
+
+	var typ string
+	d.value(m, "type", &typ)
+	pos, end := d.pos(m, "pos"), d.pos(m, "end")
+
+	switch typ {
+	case "Comment":
+		var text string
+		d.value(m, "text", &text)
+		return &Comment{Slash: pos, Text: text}
+	case "CommentGroup":
+		group := &CommentGroup{}
+		for _, raw := range d.list(m, "list") {
+			c, ok := d.node(raw).(*Comment)
+			if !ok {
+				d.errorf("CommentGroup.list holds a non-comment")
+				return nil
+			}
+			group.List = append(group.List, c)
+		}
+		return group
+	case "Program":
+		program := &Program{}
+		d.groups = make(map[token.Position]*CommentGroup)
+		var comments []json.RawMessage
+		if _, ok := m["comments"]; ok { // absent before comments existed
+			comments = d.list(m, "comments")
+		}
+		for _, raw := range comments {
+			g := d.commentGroup(raw)
+			program.Comments = append(program.Comments, g)
+			if g != nil {
+				d.groups[g.Pos()] = g
+			}
+		}
+		program.Statements = d.statements(m, "statements")
+		return program
+	case "LetStatement":
+		return &LetStatement{
+			Doc:     d.optionalGroup(m, "doc"),
+			Token:   keyword(token.LET, "let", pos),
+			Name:    d.identifier(m, "name"),
+			Value:   d.optionalExpression(m, "value"),
+			Comment: d.optionalGroup(m, "comment"),
+		}
+	case "ReturnStatement":
+		return &ReturnStatement{
+			Doc:         d.optionalGroup(m, "doc"),
+			Token:       keyword(token.RETURN, "return", pos),
+			ReturnValue: d.optionalExpression(m, "value"),
+			Comment:     d.optionalGroup(m, "comment"),
+		}
+	case "ExpressionStatement":
+		var literal string
+		d.value(m, "literal", &literal)
+		return &ExpressionStatement{
+			Doc:        d.optionalGroup(m, "doc"),
+			Token:      token.Token{Literal: literal, Pos: pos},
+			Expression: d.optionalExpression(m, "expression"),
+			Comment:    d.optionalGroup(m, "comment"),
+		}
+	case "BlockStatement":
+		return &BlockStatement{
+			Token:      keyword(token.LBRACE, "{", pos),
+			Statements: d.statements(m, "statements"),
+			Rbrace:     d.pos(m, "rbrace"),
+		}
+	case "Identifier":
+		var value string
+		d.value(m, "value", &value)
+		return &Identifier{
+			Token: token.Token{Type: token.IDENT, Literal: value, Pos: pos,
+				End: end},
+			Value: value,
+		}
+	case "IntegerLiteral":
+		var literal string
+		var value int64
+		d.value(m, "literal", &literal)
+		d.value(m, "value", &value)
+		return &IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: literal, Pos: pos,
+				End: end},
+			Value: value,
+		}
+	case "StringLiteral":
+		var value string
+		d.value(m, "value", &value)
+		return &StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: value, Pos: pos,
+				End: end},
+			Value: value,
+		}
+	case "Boolean":
+		var value bool
+		d.value(m, "value", &value)
+		tok := keyword(token.TRUE, "true", pos)
+		if !value {
+			tok = keyword(token.FALSE, "false", pos)
+		}
+		return &Boolean{Token: tok, Value: value}
+	case "PrefixExpression":
+		var operator string
+		d.value(m, "operator", &operator)
+		return &PrefixExpression{
+			Token:    keyword(token.Type(operator), operator, pos),
+			Operator: operator,
+			Right:    d.expression(m, "right"),
+		}
+	case "InfixExpression":
+		var operator string
+		d.value(m, "operator", &operator)
+		return &InfixExpression{
+			Token: keyword(token.Type(operator), operator,
+				d.pos(m, "operatorPos")),
+			Operator: operator,
+			Left:     d.expression(m, "left"),
+			Right:    d.expression(m, "right"),
+		}
+	case "IfExpression":
+		return &IfExpression{
+			Token:       keyword(token.IF, "if", pos),
+			Condition:   d.expression(m, "condition"),
+			Consequence: d.block(m, "consequence"),
+			Alternative: d.optionalBlock(m, "alternative"),
+		}
+	case "FunctionLiteral":
+		return &FunctionLiteral{
+			Token:      keyword(token.FUNCTION, "fn", pos),
+			Parameters: d.identifiers(m, "parameters"),
+			Body:       d.block(m, "body"),
+		}
+	case "MacroLiteral":
+		return &MacroLiteral{
+			Token:      keyword(token.MACRO, "macro", pos),
+			Parameters: d.identifiers(m, "parameters"),
+			Body:       d.block(m, "body"),
+		}
+	case "CallExpression":
+		return &CallExpression{
+			Token:     keyword(token.LPAREN, "(", d.pos(m, "lparen")),
+			Function:  d.expression(m, "function"),
+			Arguments: d.expressions(m, "arguments"),
+			Rparen:    d.pos(m, "rparen"),
+		}
+	case "ArrayLiteral":
+		return &ArrayLiteral{
+			Token:    keyword(token.LBRACKET, "[", pos),
+			Elements: d.expressions(m, "elements"),
+			Rbrack:   d.pos(m, "rbrack"),
+		}
+	case "IndexExpression":
+		return &IndexExpression{
+			Token:  keyword(token.LBRACKET, "[", d.pos(m, "lbrack")),
+			Left:   d.expression(m, "left"),
+			Index:  d.expression(m, "index"),
+			Rbrack: d.pos(m, "rbrack"),
+		}
+	case "HashLiteral":
+		return &HashLiteral{
+			Token:  keyword(token.LBRACE, "{", pos),
+			Pairs:  d.pairs(m, "pairs"),
+			Rbrace: d.pos(m, "rbrace"),
+		}
+	case "BadStatement":
+		return &BadStatement{From: pos, To: end}
+	case "BadExpression":
+		return &BadExpression{From: pos, To: end}
+	}
+
+	d.errorf("unknown node type %q", typ)
+	return nil
+}
+
+// commentGroup decodes a CommentGroup.
+func (d *decoder) commentGroup(raw json.RawMessage) *CommentGroup {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	g, ok := node.(*CommentGroup)
+	if !ok {
+		d.errorf("%T is not a comment group", node)
+	}
+	return g
+}
+
+// optionalGroup decodes the CommentGroup in member key of m, if there is
+// one. A group of the Program is shared rather than duplicated.
+func (d *decoder) optionalGroup(m map[string]json.RawMessage,
+	key string) *CommentGroup {
+	raw, ok := m[key]
+	if !ok {
+		return nil
+	}
+	g := d.commentGroup(raw)
+	if g != nil {
+		if shared, ok := d.groups[g.Pos()]; ok {
+			return shared
+		}
+	}
+	return g
+}
+
+// list unmarshals the JSON array in member key of m.
+func (d *decoder) list(m map[string]json.RawMessage, key string) []json.RawMessage {
+	var list []json.RawMessage
+	d.value(m, key, &list)
+	return list
+}
+
+// null records that the required member key of an owner node is null.
+func (d *decoder) null(owner, key string) {
+	d.errorf("%s.%s is null", owner, key)
+}
+
+// expression decodes the required Expression in member key of m.
+func (d *decoder) expression(m map[string]json.RawMessage, key string) Expression {
+	expr := d.optionalExpression(m, key)
+	if expr == nil {
+		d.null(typeOf(m), key)
+	}
+	return expr
+}
+
+// optionalExpression decodes the Expression in member key of m, which may
+// be null.
+func (d *decoder) optionalExpression(m map[string]json.RawMessage,
+	key string) Expression {
+	var raw json.RawMessage
+	d.value(m, key, &raw)
+	return d.toExpression(raw)
+}
+
+// toExpression decodes an Expression.
+func (d *decoder) toExpression(raw json.RawMessage) Expression {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	expr, ok := node.(Expression)
+	if !ok {
+		d.errorf("%T is not an expression", node)
+	}
+	return expr
+}
+
+// identifier decodes the required Identifier in member key of m.
+func (d *decoder) identifier(m map[string]json.RawMessage, key string) *Identifier {
+	var raw json.RawMessage
+	d.value(m, key, &raw)
+	ident := d.toIdentifier(raw)
+	if ident == nil {
+		d.null(typeOf(m), key)
+	}
+	return ident
+}
+
+// toIdentifier decodes an Identifier.
+func (d *decoder) toIdentifier(raw json.RawMessage) *Identifier {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.errorf("%T is not an identifier", node)
+	}
+	return ident
+}
+
+// block decodes the required BlockStatement in member key of m.
+func (d *decoder) block(m map[string]json.RawMessage, key string) *BlockStatement {
+	block := d.optionalBlock(m, key)
+	if block == nil {
+		d.null(typeOf(m), key)
+	}
+	return block
+}
+
+// optionalBlock decodes the BlockStatement in member key of m, which may be
+// null.
+func (d *decoder) optionalBlock(m map[string]json.RawMessage,
+	key string) *BlockStatement {
+	var raw json.RawMessage
+	d.value(m, key, &raw)
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.errorf("%T is not a block", node)
+	}
+	return block
+}
+
+// statements decodes the list of Statements in member key of m.
+func (d *decoder) statements(m map[string]json.RawMessage, key string) []Statement {
+	out := []Statement{}
+	for _, raw := range d.list(m, key) {
+		node := d.node(raw)
+		stmt, ok := node.(Statement)
+		if node == nil {
+			d.null(typeOf(m), key+" element")
+		} else if !ok {
+			d.errorf("%T is not a statement", node)
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// expressions decodes the list of Expressions in member key of m.
+func (d *decoder) expressions(m map[string]json.RawMessage, key string) []Expression {
+	out := []Expression{}
+	for _, raw := range d.list(m, key) {
+		expr := d.toExpression(raw)
+		if expr == nil {
+			d.null(typeOf(m), key+" element")
+		}
+		out = append(out, expr)
+	}
+	return out
+}
+
+// identifiers decodes the list of Identifiers in member key of m.
+func (d *decoder) identifiers(m map[string]json.RawMessage, key string) []*Identifier {
+	out := []*Identifier{}
+	for _, raw := range d.list(m, key) {
+		ident := d.toIdentifier(raw)
+		if ident == nil {
+			d.null(typeOf(m), key+" element")
+		}
+		out = append(out, ident)
+	}
+	return out
+}
+
+// pairs decodes the list of HashPairs in member key of m.
+func (d *decoder) pairs(m map[string]json.RawMessage, key string) []HashPair {
+	out := []HashPair{}
+	for _, raw := range d.list(m, key) {
+		pm := d.members(raw)
+		if pm == nil {
+			d.null(typeOf(m), key+" element")
+			break
+		}
+		pair := HashPair{
+			Key:   d.optionalExpression(pm, "key"),
+			Value: d.optionalExpression(pm, "value"),
+		}
+		if pair.Key == nil {
+			d.null("HashPair", "key")
+		} else if pair.Value == nil {
+			d.null("HashPair", "value")
+		}
+		out = append(out, pair)
+	}
+	return out
+}
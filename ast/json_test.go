@@ -0,0 +1,204 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/parser"
+)
+
+// describeNodes returns the type, literal and extent of each node in the tree
+// rooted at node, in depth-first order.
+func describeNodes(node ast.Node) []string {
+	var out []string
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n != nil {
+			out = append(out, fmt.Sprintf("%T %q %s-%s", n, n.TokenLiteral(),
+				n.Pos(), n.End()))
+		}
+		return true
+	})
+	return out
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	p := parser.New(lexer.NewFile("walk.mk", walkInput))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("parser errors: %v", err)
+	}
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON error: %s", err)
+	}
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON error: %s", err)
+	}
+
+	if _, ok := node.(*ast.Program); !ok {
+		t.Fatalf("node is %T, want *ast.Program", node)
+	}
+	if node.String() != program.String() {
+		t.Errorf("String() is %q, want %q", node.String(), program.String())
+	}
+
+	got, want := describeNodes(node), describeNodes(program)
+	if len(got) != len(want) {
+		t.Fatalf("round trip has %d nodes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("node %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	again, err := ast.MarshalJSON(node)
+	if err != nil {
+		t.Fatalf("MarshalJSON error on round trip: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("JSON changed on round trip:\n%s\nwant\n%s", again, data)
+	}
+}
+
+func TestJSONComments(t *testing.T) {
+	input := "// doc\nlet x = 1; // trailing\nputs(x /* arg */);\n"
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("parser errors: %v", err)
+	}
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON error: %s", err)
+	}
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON error: %s", err)
+	}
+
+	decoded := node.(*ast.Program)
+	if len(decoded.Comments) != 3 {
+		t.Fatalf("decoded program has %d comment groups, want 3",
+			len(decoded.Comments))
+	}
+	let := decoded.Statements[0].(*ast.LetStatement)
+	if let.Doc != decoded.Comments[0] || let.Comment != decoded.Comments[1] {
+		t.Errorf("comments of let statement are %v and %v, want the "+
+			"program's groups %v and %v", let.Doc, let.Comment,
+			decoded.Comments[0], decoded.Comments[1])
+	}
+	got, want := describeNodes(decoded), describeNodes(program)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded nodes are\n%q\nwant\n%q", got, want)
+	}
+	if text := decoded.Comments[2].List[0].Text; text != "/* arg */" {
+		t.Errorf("third comment is %q, want %q", text, "/* arg */")
+	}
+}
+
+func TestJSONShape(t *testing.T) {
+	program := parse(t, "x + 1")
+	data, err := ast.MarshalJSON(program.Statements[0].(*ast.ExpressionStatement).Expression)
+	if err != nil {
+		t.Fatalf("MarshalJSON error: %s", err)
+	}
+
+	expected := `{"type":"InfixExpression",` +
+		`"pos":{"offset":0,"line":1,"column":1},` +
+		`"end":{"offset":5,"line":1,"column":6},` +
+		`"operatorPos":{"offset":2,"line":1,"column":3},` +
+		`"operator":"+",` +
+		`"left":{"type":"Identifier",` +
+		`"pos":{"offset":0,"line":1,"column":1},` +
+		`"end":{"offset":1,"line":1,"column":2},"value":"x"},` +
+		`"right":{"type":"IntegerLiteral",` +
+		`"pos":{"offset":4,"line":1,"column":5},` +
+		`"end":{"offset":5,"line":1,"column":6},"literal":"1","value":1}}`
+	if string(data) != expected {
+		t.Errorf("JSON is\n%s\nwant\n%s", data, expected)
+	}
+}
+
+func TestJSONMissingNodes(t *testing.T) {
+	input := &ast.IfExpression{
+		Condition:   &ast.Boolean{Value: true},
+		Consequence: &ast.BlockStatement{},
+	}
+
+	data, err := ast.MarshalJSON(input)
+	if err != nil {
+		t.Fatalf("MarshalJSON error: %s", err)
+	}
+	if !strings.Contains(string(data), `"alternative":null`) {
+		t.Errorf("JSON is %s, want a null alternative", data)
+	}
+
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON error: %s", err)
+	}
+	if alt := node.(*ast.IfExpression).Alternative; alt != nil {
+		t.Errorf("Alternative is %#v, want nil", alt)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2]`, "cannot unmarshal array"},
+		{`{"type":"Widget"}`, `unknown node type "Widget"`},
+		{`{"type":"Identifier"}`, `Identifier is missing "value"`},
+		{`{"type":"ReturnStatement","value":{"type":"BlockStatement",` +
+			`"statements":[]}}`, "*ast.BlockStatement is not an expression"},
+		{`{"type":"FunctionLiteral","parameters":[{"type":"Boolean",` +
+			`"value":true}],"body":null}`, "*ast.Boolean is not an identifier"},
+		{`{"type":"Program","statements":[{"type":"Boolean","value":true}]}`,
+			"*ast.Boolean is not a statement"},
+		{`{"type":"Program"`, "unexpected end of JSON input"},
+		{`{"type":"InfixExpression","operator":"+","left":null,` +
+			`"right":{"type":"Boolean","value":true}}`,
+			"InfixExpression.left is null"},
+		{`{"type":"PrefixExpression","operator":"!","right":null}`,
+			"PrefixExpression.right is null"},
+		{`{"type":"LetStatement","name":null,"value":null}`,
+			"LetStatement.name is null"},
+		{`{"type":"IfExpression","condition":{"type":"Boolean",` +
+			`"value":true},"consequence":null,"alternative":null}`,
+			"IfExpression.consequence is null"},
+		{`{"type":"FunctionLiteral","parameters":[],"body":null}`,
+			"FunctionLiteral.body is null"},
+		{`{"type":"Program","statements":[null]}`,
+			"Program.statements element is null"},
+		{`{"type":"ArrayLiteral","elements":[null]}`,
+			"ArrayLiteral.elements element is null"},
+		{`{"type":"FunctionLiteral","parameters":[null],"body":null}`,
+			"FunctionLiteral.parameters element is null"},
+		{`{"type":"HashLiteral","pairs":[null]}`,
+			"HashLiteral.pairs element is null"},
+		{`{"type":"HashLiteral","pairs":[{"key":{"type":"Boolean",` +
+			`"value":true},"value":null}]}`, "HashPair.value is null"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.UnmarshalJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("UnmarshalJSON(%s) succeeded, want error %q", tt.input,
+				tt.expected)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("UnmarshalJSON(%s) error is %q, want it to contain %q",
+				tt.input, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package ast // import "github.com/pto/monkey/ast"
+
+// ModifierFunc is called by Modify for each Node, and returns the Node to
+// replace it with.
+type ModifierFunc func(Node) Node
+
+// Modify traverses the tree rooted at node depth-first, replacing the
+// children of each Node, and then the Node itself, with the result of calling
+// modifier on them. It returns the result of calling modifier on node.
+//
+// A child replaced by a Node of the wrong kind for its field, such as a
+// Statement in place of an Expression, becomes nil.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+
+	case *LetStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+
+	case *ExpressionStatement:
+		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+
+	case *BlockStatement:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		node.Alternative = modifyBlock(node.Alternative, modifier)
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = Modify(arg, modifier).(Expression)
+		}
+
+	case *ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i], _ = Modify(element, modifier).(Expression)
+		}
+
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+
+	case *HashLiteral:
+		for i, pair := range node.Pairs {
+			node.Pairs[i].Key, _ = Modify(pair.Key, modifier).(Expression)
+			node.Pairs[i].Value, _ = Modify(pair.Value, modifier).(Expression)
+		}
+
+	case nil:
+		return nil
+	}
+
+	// Identifier, IntegerLiteral, StringLiteral, Boolean, BadStatement and
+	// BadExpression have no children, and comments are left unchanged.
+
+	return modifier(node)
+}
+
+// modifyIdentifier applies Modify to an Identifier field. It stays nil if it
+// is nil.
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	modified, _ := Modify(ident, modifier).(*Identifier)
+	return modified
+}
+
+// modifyBlock applies Modify to a BlockStatement field. It stays nil if it
+// is nil.
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	modified, _ := Modify(block, modifier).(*BlockStatement)
+	return modified
+}
+
+// Copy returns a deep copy of the tree rooted at node, so that it can be
+// changed by Modify without affecting the original.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Comment:
+		c := *node
+		return &c
+	case *CommentGroup:
+		return copyCommentGroup(node)
+	case *Program:
+		c := *node
+		c.Statements = copyStatements(node.Statements)
+		if node.Comments != nil {
+			c.Comments = make([]*CommentGroup, len(node.Comments))
+			for i, g := range node.Comments {
+				c.Comments[i] = copyCommentGroup(g)
+			}
+		}
+		return &c
+	case *LetStatement:
+		c := *node
+		c.Doc = copyCommentGroup(node.Doc)
+		c.Name = copyIdentifier(node.Name)
+		c.Value = copyExpression(node.Value)
+		c.Comment = copyCommentGroup(node.Comment)
+		return &c
+	case *ReturnStatement:
+		c := *node
+		c.Doc = copyCommentGroup(node.Doc)
+		c.ReturnValue = copyExpression(node.ReturnValue)
+		c.Comment = copyCommentGroup(node.Comment)
+		return &c
+	case *ExpressionStatement:
+		c := *node
+		c.Doc = copyCommentGroup(node.Doc)
+		c.Expression = copyExpression(node.Expression)
+		c.Comment = copyCommentGroup(node.Comment)
+		return &c
+	case *BlockStatement:
+		return copyBlock(node)
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		c := *node
+		return &c
+	case *StringLiteral:
+		c := *node
+		return &c
+	case *Boolean:
+		c := *node
+		return &c
+	case *PrefixExpression:
+		c := *node
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *InfixExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *IfExpression:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Consequence = copyBlock(node.Consequence)
+		c.Alternative = copyBlock(node.Alternative)
+		return &c
+	case *FunctionLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *CallExpression:
+		c := *node
+		c.Function = copyExpression(node.Function)
+		c.Arguments = copyExpressions(node.Arguments)
+		return &c
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = copyExpressions(node.Elements)
+		return &c
+	case *IndexExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Index = copyExpression(node.Index)
+		return &c
+	case *HashLiteral:
+		c := *node
+		if node.Pairs != nil {
+			c.Pairs = make([]HashPair, len(node.Pairs))
+			for i, pair := range node.Pairs {
+				c.Pairs[i] = HashPair{Key: copyExpression(pair.Key),
+					Value: copyExpression(pair.Value)}
+			}
+		}
+		return &c
+	case *BadStatement:
+		c := *node
+		return &c
+	case *BadExpression:
+		c := *node
+		return &c
+	}
+	return node
+}
+
+// copyExpression copies an Expression field, which may be nil.
+func copyExpression(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	c, _ := Copy(e).(Expression)
+	return c
+}
+
+// copyExpressions copies an Expression slice, which may be nil.
+func copyExpressions(exprs []Expression) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	c := make([]Expression, len(exprs))
+	for i, e := range exprs {
+		c[i] = copyExpression(e)
+	}
+	return c
+}
+
+// copyStatements copies a Statement slice, which may be nil.
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	c := make([]Statement, len(stmts))
+	for i, s := range stmts {
+		c[i], _ = Copy(s).(Statement)
+	}
+	return c
+}
+
+// copyIdentifier copies an Identifier field, which may be nil.
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+// copyIdentifiers copies an Identifier slice, which may be nil.
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		c[i] = copyIdentifier(ident)
+	}
+	return c
+}
+
+// copyBlock copies a BlockStatement field, which may be nil.
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	c := *block
+	c.Statements = copyStatements(block.Statements)
+	return &c
+}
+
+// copyCommentGroup copies a CommentGroup field, which may be nil.
+func copyCommentGroup(g *CommentGroup) *CommentGroup {
+	if g == nil {
+		return nil
+	}
+	c := &CommentGroup{}
+	if g.List != nil {
+		c.List = make([]*Comment, len(g.List))
+		for i, comment := range g.List {
+			copied := *comment
+			c.List[i] = &copied
+		}
+	}
+	return c
+}
@@ -0,0 +1,206 @@
+package ast // import "github.com/pto/monkey/ast"
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pto/monkey/token"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{
+				&ExpressionStatement{Expression: one()},
+			}},
+			&Program{Statements: []Statement{
+				&ExpressionStatement{Expression: two()},
+			}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&IfExpression{Condition: one(), Consequence: &BlockStatement{}},
+			&IfExpression{Condition: two(), Consequence: &BlockStatement{}},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: ident("x"), Value: one()},
+			&LetStatement{Name: ident("x"), Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{
+				one(), one(),
+			}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{
+				two(), two(),
+			}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{
+				{Key: one(), Value: one()},
+				{Key: one(), Value: one()},
+			}},
+			&HashLiteral{Pairs: []HashPair{
+				{Key: two(), Value: two()},
+				{Key: two(), Value: two()},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("modified is %#v, want %#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyReplacesNodes(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"},
+			Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "y"}},
+		&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+	}}
+
+	renameX := func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return &Identifier{Value: "z"}
+		}
+		return node
+	}
+
+	modified := Modify(program, renameX)
+	if modified.String() != "let z = y;z" {
+		t.Errorf("modified is %q, want %q", modified.String(), "let z = y;z")
+	}
+
+	count := 0
+	Modify(program, func(node Node) Node {
+		count++
+		return node
+	})
+	if count != 6 {
+		t.Errorf("modifier called %d times, want 6", count)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	program := func() *Program {
+		return &Program{Statements: []Statement{
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: &Identifier{Value: "f"},
+				Arguments: []Expression{
+					&InfixExpression{Left: &IntegerLiteral{Value: 1},
+						Operator: "+", Right: &IntegerLiteral{Value: 2}},
+					&HashLiteral{Pairs: []HashPair{{
+						Key:   &StringLiteral{Value: "k"},
+						Value: &IntegerLiteral{Value: 1},
+					}}},
+				},
+			}},
+		}}
+	}
+	original := program()
+
+	copied := Copy(original)
+	if !reflect.DeepEqual(copied, original) {
+		t.Fatalf("copy is %#v, want %#v", copied, original)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 99
+		}
+		return node
+	})
+	if !reflect.DeepEqual(original, program()) {
+		t.Errorf("modifying the copy changed the original to %#v", original)
+	}
+}
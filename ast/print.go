@@ -0,0 +1,109 @@
+package ast // import "github.com/pto/monkey/ast"
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/pto/monkey/token"
+)
+
+var (
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType    = reflect.TypeOf(token.Token{})
+	positionType = reflect.TypeOf(token.Position{})
+)
+
+// Fprint writes node to w as an indented tree, one node per line. Each line
+// shows the node type, its scalar fields and its position; child nodes are
+// labeled with the name of the field that holds them.
+func Fprint(w io.Writer, node Node) error {
+	p := printer{w: w}
+	p.node("", reflect.ValueOf(node), 0)
+	return p.err
+}
+
+// printer holds the state of Fprint.
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+// printf writes a formatted line to the printer, remembering the first error.
+func (p *printer) printf(depth int, format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, strings.Repeat("  ", depth)+format+"\n",
+		args...)
+}
+
+// node prints the Node in v, labeled with label, and its children.
+func (p *printer) node(label string, v reflect.Value, depth int) {
+	for v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return
+	}
+	n := v.Interface().(Node)
+
+	s := v.Elem()
+	line := label + s.Type().Name()
+	for i := 0; i < s.NumField(); i++ {
+		f, ft := s.Field(i), s.Type().Field(i)
+		if ft.PkgPath != "" || ft.Type == tokenType || ft.Type == positionType {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			line += fmt.Sprintf(" %s=%q", ft.Name, f.String())
+		case reflect.Bool, reflect.Int, reflect.Int64:
+			line += fmt.Sprintf(" %s=%v", ft.Name, f.Interface())
+		}
+	}
+	if pos := n.Pos(); pos.IsValid() {
+		line += fmt.Sprintf(" (%d:%d)", pos.Line, pos.Column)
+	}
+	p.printf(depth, "%s", line)
+
+	for i := 0; i < s.NumField(); i++ {
+		f, ft := s.Field(i), s.Type().Field(i)
+		if ft.PkgPath != "" {
+			continue
+		}
+		p.field(ft.Name, f, depth+1)
+	}
+}
+
+// field prints the child nodes held in the struct field f, if any.
+func (p *printer) field(name string, f reflect.Value, depth int) {
+	switch {
+	case f.Type().Implements(nodeType):
+		p.node(name+": ", f, depth)
+	case f.Kind() == reflect.Slice && f.Type().Elem().Implements(nodeType):
+		if f.Len() == 0 {
+			return
+		}
+		p.printf(depth, "%s:", name)
+		for i := 0; i < f.Len(); i++ {
+			p.node(fmt.Sprintf("[%d] ", i), f.Index(i), depth+1)
+		}
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Struct:
+		// Groups of nodes that are not nodes themselves, such as HashPairs.
+		if f.Len() == 0 {
+			return
+		}
+		p.printf(depth, "%s:", name)
+		for i := 0; i < f.Len(); i++ {
+			e := f.Index(i)
+			p.printf(depth+1, "[%d] %s", i, e.Type().Name())
+			for j := 0; j < e.NumField(); j++ {
+				if e.Type().Field(j).PkgPath == "" {
+					p.field(e.Type().Field(j).Name, e.Field(j), depth+2)
+				}
+			}
+		}
+	}
+}
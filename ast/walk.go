@@ -0,0 +1,169 @@
+package ast // import "github.com/pto/monkey/ast"
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor w for
+// each of the non-nil children of node, in source order, followed by a call
+// of w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Comment:
+		// nothing to do
+
+	case *CommentGroup:
+		for _, c := range n.List {
+			Walk(v, c)
+		}
+
+	case *Program:
+		// The Comments are not walked; those attached to statements are
+		// visited through them.
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		walkCommentGroup(v, n.Doc)
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkExpression(v, n.Value)
+		walkCommentGroup(v, n.Comment)
+
+	case *ReturnStatement:
+		walkCommentGroup(v, n.Doc)
+		walkExpression(v, n.ReturnValue)
+		walkCommentGroup(v, n.Comment)
+
+	case *ExpressionStatement:
+		walkCommentGroup(v, n.Doc)
+		walkExpression(v, n.Expression)
+		walkCommentGroup(v, n.Comment)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean,
+		*BadStatement, *BadExpression:
+		// nothing to do
+
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		walkIdentifiers(v, n.Parameters)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *MacroLiteral:
+		walkIdentifiers(v, n.Parameters)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkExpression(v, pair.Key)
+			walkExpression(v, pair.Value)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// walkCommentGroup walks g if it is not nil.
+func walkCommentGroup(v Visitor, g *CommentGroup) {
+	if g != nil {
+		Walk(v, g)
+	}
+}
+
+// walkExpression walks e if it is not nil.
+func walkExpression(v Visitor, e Expression) {
+	if e != nil {
+		Walk(v, e)
+	}
+}
+
+// walkExpressions walks each non-nil Expression in list.
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walkExpression(v, e)
+	}
+}
+
+// walkStatements walks each non-nil Statement in list.
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+// walkIdentifiers walks each non-nil Identifier in list.
+func walkIdentifiers(v Visitor, list []*Identifier) {
+	for _, ident := range list {
+		if ident != nil {
+			Walk(v, ident)
+		}
+	}
+}
+
+type inspector func(Node) bool
+
+// Visit calls the inspector function, and continues into the children of
+// node if it returns true.
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a call
+// of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
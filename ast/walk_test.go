@@ -0,0 +1,233 @@
+package ast_test
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/parser"
+)
+
+const walkInput = `let add = fn(a, b) { a + b };
+let unless = macro(c, t, e) { quote(if (!(unquote(c))) { unquote(t) } else { unquote(e) }) };
+let data = {"one": [1, 2, 3], "two": true};
+if (add(1, 2) > 2) {
+	return data["one"][0];
+} else {
+	puts(-5, "five", false);
+}
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("parser errors: %v", err)
+	}
+	return program
+}
+
+func TestInspectCountsNodes(t *testing.T) {
+	expected := map[string]int{
+		"Program":             1,
+		"LetStatement":        3,
+		"ReturnStatement":     1,
+		"ExpressionStatement": 6,
+		"BlockStatement":      6,
+		"Identifier":          20,
+		"IntegerLiteral":      8,
+		"StringLiteral":       4,
+		"Boolean":             2,
+		"PrefixExpression":    2,
+		"InfixExpression":     2,
+		"IfExpression":        2,
+		"FunctionLiteral":     1,
+		"MacroLiteral":        1,
+		"CallExpression":      6,
+		"ArrayLiteral":        1,
+		"IndexExpression":     2,
+		"HashLiteral":         1,
+	}
+
+	counts := make(map[string]int)
+	nils := 0
+	ast.Inspect(parse(t, walkInput), func(node ast.Node) bool {
+		if node == nil {
+			nils++
+			return true
+		}
+		counts[reflect.TypeOf(node).Elem().Name()]++
+		return true
+	})
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("counts are %v, want %v", counts, expected)
+	}
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if nils != total {
+		t.Errorf("f(nil) called %d times, want %d (once per node)", nils,
+			total)
+	}
+}
+
+func TestInspectOrderAndPruning(t *testing.T) {
+	program := parse(t, "let x = f(1 + 2, fn(y) { y });")
+
+	var visited []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		visited = append(visited, node.String())
+		_, isFunction := node.(*ast.FunctionLiteral)
+		return !isFunction
+	})
+
+	expected := []string{
+		"let x = f((1 + 2), fn(y) y);",
+		"let x = f((1 + 2), fn(y) y);",
+		"x",
+		"f((1 + 2), fn(y) y)",
+		"f",
+		"(1 + 2)",
+		"1",
+		"2",
+		"fn(y) y",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("visited\n%s\nwant\n%s", strings.Join(visited, "\n"),
+			strings.Join(expected, "\n"))
+	}
+}
+
+// depthVisitor records the depth of each Identifier.
+type depthVisitor struct {
+	depth  int
+	depths map[string]int
+}
+
+func (v *depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+	if ident, ok := node.(*ast.Identifier); ok {
+		v.depths[ident.Value] = v.depth
+	}
+	return &depthVisitor{depth: v.depth + 1, depths: v.depths}
+}
+
+func TestWalkVisitor(t *testing.T) {
+	program := parse(t, "a; -b; [c[d]];")
+
+	v := &depthVisitor{depths: make(map[string]int)}
+	ast.Walk(v, program)
+
+	expected := map[string]int{"a": 2, "b": 3, "c": 4, "d": 4}
+	if !reflect.DeepEqual(v.depths, expected) {
+		t.Errorf("depths are %v, want %v", v.depths, expected)
+	}
+}
+
+func TestInspectComments(t *testing.T) {
+	program := parse(t, "// doc\nlet x = 1; // trailing\n")
+
+	var visited []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Comment:
+			visited = append(visited, n.Text)
+		case *ast.Identifier:
+			visited = append(visited, n.Value)
+		}
+		return true
+	})
+
+	expected := []string{"// doc", "x", "// trailing"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("visited %q, want %q", visited, expected)
+	}
+}
+
+// TestWalkCoversAllNodes checks that Walk handles every Node type declared
+// in the ast package, so that a new type cannot be added without it.
+func TestWalkCoversAllNodes(t *testing.T) {
+	nodes := []ast.Node{
+		&ast.Program{}, &ast.LetStatement{}, &ast.ReturnStatement{},
+		&ast.ExpressionStatement{}, &ast.BlockStatement{}, &ast.Identifier{},
+		&ast.IntegerLiteral{}, &ast.StringLiteral{}, &ast.Boolean{},
+		&ast.PrefixExpression{}, &ast.InfixExpression{}, &ast.IfExpression{},
+		&ast.FunctionLiteral{}, &ast.MacroLiteral{}, &ast.CallExpression{},
+		&ast.ArrayLiteral{}, &ast.IndexExpression{}, &ast.HashLiteral{},
+		&ast.BadStatement{}, &ast.BadExpression{}, &ast.Comment{},
+		&ast.CommentGroup{List: []*ast.Comment{{}}},
+	}
+
+	var tested []string
+	for _, node := range nodes {
+		name := reflect.TypeOf(node).Elem().Name()
+		tested = append(tested, name)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Walk(%s): %v", name, r)
+				}
+			}()
+			ast.Inspect(node, func(ast.Node) bool { return true })
+		}()
+	}
+
+	declared, err := declaredNodeTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tested)
+	if !reflect.DeepEqual(tested, declared) {
+		t.Errorf("tested node types are %v, want %v", tested, declared)
+	}
+}
+
+// declaredNodeTypes returns the sorted names of the types in the ast
+// package source with a Pos method.
+func declaredNodeTypes() ([]string, error) {
+	fset := gotoken.NewFileSet()
+	pkgs, err := goparser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg, ok := pkgs["ast"]
+	if !ok {
+		return nil, fmt.Errorf("package ast not found")
+	}
+
+	var names []string
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "Pos" {
+				continue
+			}
+			star, ok := fn.Recv.List[0].Type.(*goast.StarExpr)
+			if !ok {
+				continue
+			}
+			if ident, ok := star.X.(*goast.Ident); ok {
+				names = append(names, ident.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
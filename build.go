@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pto/monkey/compiler"
+)
+
+// buildCmd implements "monkey build [-o out.mkc] file.mk".
+func buildCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "",
+		"write the compiled program to `file` (default: the source file "+
+			"name with extension .mkc)")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey build [-o out.mkc] file.mk\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	filename := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mkc"
+	}
+
+	program, _, ok := parseFile(filename, stderr)
+	if !ok {
+		return exitError
+	}
+	if program, ok = expandMacros(filename, program, stdout, stderr); !ok {
+		return exitError
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "%s: compile error: %s\n", filename, err)
+		return exitError
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, c.Bytecode()); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", filename, err)
+		return exitError
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,227 @@
+// Package code defines the bytecode instructions of the Monkey virtual
+// machine.
+package code // import "github.com/pto/monkey/code"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pto/monkey/token"
+)
+
+// Instructions is a sequence of encoded instructions, each an Opcode followed
+// by its operands.
+type Instructions []byte
+
+// String returns a disassembly of the instructions, one per line, giving the
+// offset, mnemonic and operands of each.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for offset := 0; offset < len(ins); {
+		def, operands, width, err := ins.Decode(offset)
+		if err != nil {
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", offset, err)
+		} else {
+			fmt.Fprintf(&out, "%04d %s\n", offset, Format(def, operands))
+		}
+		offset += width
+	}
+
+	return out.String()
+}
+
+// Decode returns the definition and operands of the instruction at offset,
+// and its width in bytes including the Opcode. If the Opcode is undefined or
+// the instruction is truncated, it returns an error with a width that skips
+// the rest of the instructions.
+func (ins Instructions) Decode(offset int) (*Definition, []int, int, error) {
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return nil, nil, len(ins) - offset, err
+	}
+
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if offset+width > len(ins) {
+		return nil, nil, len(ins) - offset,
+			fmt.Errorf("%s truncated", def.Name)
+	}
+
+	operands, _ := ReadOperands(def, ins[offset+1:])
+	return def, operands, width, nil
+}
+
+// Format returns the mnemonic of an instruction followed by its operands.
+func Format(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: %s has %d operands, want %d", def.Name,
+			len(operands), len(def.OperandWidths))
+	}
+
+	parts := []string{def.Name}
+	for _, o := range operands {
+		parts = append(parts, fmt.Sprint(o))
+	}
+	return strings.Join(parts, " ")
+}
+
+// SourceMap records the position of the source code that each instruction
+// was compiled from, by offset.
+type SourceMap map[int]token.Position
+
+// Opcode identifies an instruction.
+type Opcode byte
+
+// Enumeration of Opcodes. The values are part of the compiled file format, so
+// new Opcodes must be added at the end.
+const (
+	OpConstant       Opcode = iota // push constant [index]
+	OpPop                          // pop and discard
+	OpAdd                          // pop b, a; push a + b
+	OpSub                          // pop b, a; push a - b
+	OpMul                          // pop b, a; push a * b
+	OpDiv                          // pop b, a; push a / b
+	OpTrue                         // push true
+	OpFalse                        // push false
+	OpNull                         // push null
+	OpEqual                        // pop b, a; push a == b
+	OpNotEqual                     // pop b, a; push a != b
+	OpGreaterThan                  // pop b, a; push a > b
+	OpLessThan                     // pop b, a; push a < b
+	OpMinus                        // pop a; push -a
+	OpBang                         // pop a; push !a
+	OpJump                         // jump to [offset]
+	OpJumpNotTruthy                // pop a; jump to [offset] if a is not truthy
+	OpGetGlobal                    // push global [index]
+	OpSetGlobal                    // pop a into global [index]
+	OpGetLocal                     // push local [index]
+	OpSetLocal                     // pop a into local [index]
+	OpGetBuiltin                   // push builtin [index]
+	OpGetFree                      // push free variable [index]
+	OpCurrentClosure               // push the executing closure
+	OpArray                        // pop [count] elements; push an array
+	OpHash                         // pop [count] keys and values; push a hash
+	OpIndex                        // pop index, a; push a[index]
+	OpCall                         // call the function under [count] arguments
+	OpReturnValue                  // return the value on top of the stack
+	OpReturn                       // return null
+	OpClosure                      // push a closure of constant [index] over [count] free variables
+)
+
+// Definition describes an Opcode for encoding and decoding.
+type Definition struct {
+	Name          string
+	OperandWidths []int // width in bytes of each operand
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:       {"OpConstant", []int{2}},
+	OpPop:            {"OpPop", []int{}},
+	OpAdd:            {"OpAdd", []int{}},
+	OpSub:            {"OpSub", []int{}},
+	OpMul:            {"OpMul", []int{}},
+	OpDiv:            {"OpDiv", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpEqual:          {"OpEqual", []int{}},
+	OpNotEqual:       {"OpNotEqual", []int{}},
+	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpMinus:          {"OpMinus", []int{}},
+	OpBang:           {"OpBang", []int{}},
+	OpJump:           {"OpJump", []int{2}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpCall:           {"OpCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}},
+}
+
+// Lookup returns the Definition of the Opcode op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction. It returns an empty slice if op is undefined.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// MaxOperand returns the largest operand that fits in width bytes.
+func MaxOperand(width int) int {
+	return 1<<(8*uint(width)) - 1
+}
+
+// ReadOperands decodes the operands of an instruction, which start at the
+// beginning of ins, and returns them with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two-byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one-byte operand.
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
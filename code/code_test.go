@@ -0,0 +1,131 @@
+package code // import "github.com/pto/monkey/code"
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if !bytes.Equal(instruction, tt.expected) {
+			t.Errorf("Make(%d, %v) is %v, want %v", tt.op, tt.operands,
+				instruction, tt.expected)
+		}
+	}
+}
+
+func TestMaxOperand(t *testing.T) {
+	tests := []struct {
+		width    int
+		expected int
+	}{
+		{0, 0},
+		{1, 255},
+		{2, 65535},
+	}
+
+	for _, tt := range tests {
+		if max := MaxOperand(tt.width); max != tt.expected {
+			t.Errorf("MaxOperand(%d) is %d, want %d", tt.width, max,
+				tt.expected)
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n is %d, want %d", n, tt.bytesRead)
+		}
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand %d is %d, want %d", i, operandsRead[i], want)
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for op := OpConstant; op <= OpClosure; op++ {
+		if _, err := Lookup(byte(op)); err != nil {
+			t.Errorf("Lookup(%d): %s", op, err)
+		}
+	}
+	if _, err := Lookup(255); err == nil {
+		t.Errorf("Lookup(255) succeeded, want an error")
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions are\n%s\nwant\n%s", concatted, expected)
+	}
+}
+
+func TestInstructionsStringErrors(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{Instructions{255, byte(OpAdd)}, "0000 ERROR: opcode 255 undefined\n"},
+		{append(Make(OpPop), byte(OpConstant), 1),
+			"0000 OpPop\n0001 ERROR: OpConstant truncated\n"},
+	}
+
+	for _, tt := range tests {
+		if tt.ins.String() != tt.expected {
+			t.Errorf("instructions %v are %q, want %q", []byte(tt.ins),
+				tt.ins.String(), tt.expected)
+		}
+	}
+}
@@ -0,0 +1,589 @@
+// Package compiler translates Monkey programs into bytecode for the virtual
+// machine.
+package compiler // import "github.com/pto/monkey/compiler"
+
+import (
+	"fmt"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/code"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/token"
+)
+
+// Bytecode is the output of a Compiler: the instructions of the main program
+// and the constants they refer to.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	SourceMap    code.SourceMap // positions of the main program instructions
+}
+
+// EmittedInstruction records an instruction written by a Compiler.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int // offset of the instruction
+}
+
+// CompilationScope holds the instructions of the main program or of one
+// function literal while it is being compiled.
+type CompilationScope struct {
+	instructions        code.Instructions
+	sourceMap           code.SourceMap
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+// newCompilationScope creates an empty CompilationScope.
+func newCompilationScope() CompilationScope {
+	return CompilationScope{sourceMap: make(code.SourceMap)}
+}
+
+// Compiler translates the AST of a program into Bytecode.
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	scopes      []CompilationScope
+	scopeIndex  int
+	pos         token.Position  // position of the node being compiled
+	err         error           // first error found, if any
+	pending     map[string]bool // globals declared but not yet bound
+}
+
+// New creates a new Compiler with an empty global scope.
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
+	return &Compiler{
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{newCompilationScope()},
+		pending:     make(map[string]bool),
+	}
+}
+
+// Bytecode returns the result of the compilation.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+	}
+}
+
+// Compile translates node and its children, appending to the instructions
+// of the current scope. Errors, including an operand too large for its
+// instruction, such as the index of a constant past the 65536th, are
+// reported at the position of the node that causes them.
+//
+// The globals bound by the let statements of a Program are declared before
+// any of it is compiled, so that, as in the evaluator, a function can refer
+// to a global bound after it, and top-level functions can call each other.
+// Outside functions, a global can only be used after it is bound.
+func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil && node.Pos().IsValid() {
+		defer func(pos token.Position) { c.pos = pos }(c.pos)
+		c.pos = node.Pos()
+	}
+
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+// compile translates node and its children for Compile.
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.declareGlobals(node.Statements)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		return nil
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		return nil
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+		return nil
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+		return nil
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+		return nil
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok || c.scopeIndex == 0 && c.pending[node.Value] {
+			return c.errorf("identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+		return nil
+
+	case *ast.PrefixExpression:
+		return c.compilePrefixExpression(node)
+
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+		return nil
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+		return nil
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+		return nil
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		return nil
+	}
+
+	if node == nil {
+		return c.errorf("missing expression")
+	}
+	return c.errorf("unsupported node: %T", node)
+}
+
+// declareGlobals defines the names bound by the let statements in a list of
+// top-level statements that are not globals already. They are pending until
+// their let statements are compiled.
+func (c *Compiler) declareGlobals(statements []ast.Statement) {
+	if c.scopeIndex != 0 {
+		return
+	}
+	defer func(pos token.Position) { c.pos = pos }(c.pos)
+	for _, s := range statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		if symbol, ok := c.symbolTable.Resolve(let.Name.Value); ok &&
+			symbol.Scope == GlobalScope {
+			continue
+		}
+		c.pos = let.Pos()
+		c.define(let.Name.Value)
+		c.pending[let.Name.Value] = true
+	}
+}
+
+// compileLetStatement compiles a let statement. The name is bound after its
+// value is compiled, so a function literal refers to itself through the
+// function name instead. A global that is bound again keeps its slot, so
+// that functions referring to it see the new value.
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	var err error
+	if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+		err = c.compileFunctionLiteral(fn, node.Name.Value)
+	} else {
+		err = c.Compile(node.Value)
+	}
+	if err != nil {
+		return err
+	}
+
+	symbol := c.bind(node.Name.Value)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+	return nil
+}
+
+// compilePrefixExpression compiles a prefix operator and its operand.
+func (c *Compiler) compilePrefixExpression(node *ast.PrefixExpression) error {
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "!":
+		c.emit(code.OpBang)
+	case "-":
+		c.emit(code.OpMinus)
+	default:
+		return c.errorf("unknown operator: %s", node.Operator)
+	}
+	return nil
+}
+
+// infixOpcodes maps infix operators to their instructions.
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+}
+
+// compileInfixExpression compiles an infix operator and its operands, left
+// to right.
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return c.errorf("unknown operator: %s", node.Operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+// compileIfExpression compiles a conditional. Each branch leaves exactly one
+// value on the stack, null if it has none.
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Emit jumps with a bogus offset, to be replaced once it is known.
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBranch(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBranch(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBranch compiles a branch of a conditional so that the value of its
+// last expression statement stays on the stack.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileFunctionLiteral compiles a function literal into a constant and
+// emits an instruction to make a closure of it. A non-empty name is bound to
+// the function within its own body.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _, p := range node.Parameters {
+		c.define(p.Value)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		c.leaveScope()
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		SourceMap:     sourceMap,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// define binds name in the current scope, checking that its index fits in
+// the operand of the instructions that store and load it.
+func (c *Compiler) define(name string) Symbol {
+	symbol := c.symbolTable.Define(name)
+	if symbol.Scope == GlobalScope {
+		c.checkOperands(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.checkOperands(code.OpSetLocal, symbol.Index)
+	}
+	return symbol
+}
+
+// bind returns the Symbol that a let statement binds name to: the existing
+// slot if name is a global, or a new one.
+func (c *Compiler) bind(name string) Symbol {
+	if c.scopeIndex == 0 {
+		symbol, ok := c.symbolTable.Resolve(name)
+		if ok && symbol.Scope == GlobalScope {
+			delete(c.pending, name)
+			return symbol
+		}
+	}
+	return c.define(name)
+}
+
+// loadSymbol emits an instruction to push the value of symbol.
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// addConstant appends obj to the constants and returns its index, checking
+// that the index fits in the operand of OpConstant.
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	c.checkOperands(code.OpConstant, len(c.constants)-1)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction to the current scope and returns its offset.
+// An operand that does not fit is recorded as an error.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+// addInstruction appends encoded instructions to the current scope and
+// returns their offset.
+func (c *Compiler) addInstruction(ins []byte) int {
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return pos
+}
+
+// setLastInstruction records the instruction just emitted, and the source
+// position it was compiled from.
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	if c.pos.IsValid() {
+		scope.sourceMap[pos] = c.pos
+	}
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+}
+
+// currentInstructions returns the instructions of the current scope.
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// lastInstructionIs reports whether op is the last instruction emitted in
+// the current scope.
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+// removeLastPop removes the last instruction, an OpPop.
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	delete(scope.sourceMap, scope.lastInstruction.Position)
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+// replaceLastPopWithReturn turns the last instruction, an OpPop, into an
+// OpReturnValue, so that a function returns its last expression.
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// replaceInstruction overwrites the instruction at pos with ins, which must
+// have the same length.
+func (c *Compiler) replaceInstruction(pos int, ins []byte) {
+	copy(c.currentInstructions()[pos:], ins)
+}
+
+// changeOperand replaces the operand of the instruction at pos.
+func (c *Compiler) changeOperand(pos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[pos])
+	c.checkOperands(op, operand)
+	c.replaceInstruction(pos, code.Make(op, operand))
+}
+
+// operandNames describes the operands of each opcode, for errors.
+var operandNames = map[code.Opcode][]string{
+	code.OpConstant:      {"constant index"},
+	code.OpJump:          {"jump offset"},
+	code.OpJumpNotTruthy: {"jump offset"},
+	code.OpGetGlobal:     {"global index"},
+	code.OpSetGlobal:     {"global index"},
+	code.OpGetLocal:      {"local index"},
+	code.OpSetLocal:      {"local index"},
+	code.OpGetBuiltin:    {"builtin index"},
+	code.OpGetFree:       {"free variable index"},
+	code.OpArray:         {"array length"},
+	code.OpHash:          {"hash key and value count"},
+	code.OpCall:          {"argument count"},
+	code.OpClosure:       {"constant index", "free variable count"},
+}
+
+// checkOperands records an error if an operand of op is too large for its
+// width.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		c.errorf("%s", err)
+		return
+	}
+	for i, operand := range operands {
+		max := code.MaxOperand(def.OperandWidths[i])
+		if operand < 0 || operand > max {
+			c.errorf("%s %d out of range [0, %d]", operandNames[op][i],
+				operand, max)
+			return
+		}
+	}
+}
+
+// errorf records an error at the line and column of the node being
+// compiled, unless one has already been recorded, and returns the recorded
+// error. The filename is left to the caller.
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	msg := fmt.Sprintf(format, a...)
+	if c.pos.IsValid() {
+		msg = fmt.Sprintf("%d:%d: %s", c.pos.Line, c.pos.Column, msg)
+	}
+	c.err = fmt.Errorf("%s", msg)
+	return c.err
+}
+
+// enterScope starts compiling a function literal.
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, newCompilationScope())
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope finishes compiling a function literal and returns its
+// instructions.
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
@@ -0,0 +1,110 @@
+package compiler // import "github.com/pto/monkey/compiler"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/code"
+	"github.com/pto/monkey/object"
+)
+
+// Disassemble writes a listing of the instructions of bytecode to w. The
+// constant or builtin loaded by each instruction is described in a comment,
+// and the instructions of each compiled function are listed, indented, after
+// the instruction that makes a closure of it. If src, the source code of the
+// program, is not empty, each run of instructions compiled from the same line
+// is preceded by that line.
+func Disassemble(w io.Writer, bytecode *Bytecode, src string) error {
+	d := &disassembler{constants: bytecode.Constants}
+	if src != "" {
+		d.lines = strings.Split(src, "\n")
+	}
+
+	d.disassemble(bytecode.Instructions, bytecode.SourceMap, "")
+
+	_, err := w.Write(d.out.Bytes())
+	return err
+}
+
+// disassembler holds the state of Disassemble.
+type disassembler struct {
+	out       bytes.Buffer
+	constants []object.Object
+	lines     []string // source lines, or nil
+	line      int      // number of the last source line written
+}
+
+// disassemble lists ins, compiled with sourceMap, with each line prefixed
+// by indent.
+func (d *disassembler) disassemble(ins code.Instructions,
+	sourceMap code.SourceMap, indent string) {
+	for offset := 0; offset < len(ins); {
+		if pos, ok := sourceMap[offset]; ok {
+			d.sourceLine(pos.Line, indent)
+		}
+
+		def, operands, width, err := ins.Decode(offset)
+		if err != nil {
+			fmt.Fprintf(&d.out, "%s%04d ERROR: %s\n", indent, offset, err)
+			return
+		}
+
+		text := code.Format(def, operands)
+		comment, fn := d.describe(code.Opcode(ins[offset]), operands)
+		if comment != "" {
+			fmt.Fprintf(&d.out, "%s%04d %-24s ; %s\n", indent, offset, text,
+				comment)
+		} else {
+			fmt.Fprintf(&d.out, "%s%04d %s\n", indent, offset, text)
+		}
+
+		if fn != nil {
+			d.disassemble(fn.Instructions, fn.SourceMap, indent+"    ")
+		}
+
+		offset += width
+	}
+}
+
+// sourceLine writes source line n, unless it was the last one written.
+func (d *disassembler) sourceLine(n int, indent string) {
+	if d.lines == nil || n == d.line || n < 1 || n > len(d.lines) {
+		return
+	}
+	d.line = n
+	fmt.Fprintf(&d.out, "%s; %d: %s\n", indent, n, strings.TrimSpace(d.lines[n-1]))
+}
+
+// describe returns a comment describing the constant or builtin loaded by an
+// instruction, if any. For OpClosure, it also returns the compiled function.
+func (d *disassembler) describe(op code.Opcode,
+	operands []int) (string, *object.CompiledFunction) {
+	switch op {
+	case code.OpConstant, code.OpClosure:
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name, nil
+		}
+		return "builtin out of range", nil
+	default:
+		return "", nil
+	}
+
+	index := operands[0]
+	if index >= len(d.constants) {
+		return "constant out of range", nil
+	}
+
+	switch constant := d.constants[index].(type) {
+	case *object.String:
+		return ast.Quote(constant.Value), nil
+	case *object.CompiledFunction:
+		return fmt.Sprintf("fn: params %d, locals %d",
+			constant.NumParameters, constant.NumLocals), constant
+	default:
+		return constant.Inspect(), nil
+	}
+}
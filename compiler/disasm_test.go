@@ -0,0 +1,53 @@
+package compiler // import "github.com/pto/monkey/compiler"
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let greet = fn(name) {
+	"hello " + name
+};
+puts(greet("you"));
+`
+	expected := `; 1: let greet = fn(name) {
+0000 OpClosure 1 0            ; fn: params 1, locals 1
+    ; 2: "hello " + name
+    0000 OpConstant 0             ; "hello "
+    0003 OpGetLocal 0
+    0005 OpAdd
+    0006 OpReturnValue
+; 1: let greet = fn(name) {
+0004 OpSetGlobal 0
+; 4: puts(greet("you"));
+0007 OpGetBuiltin 1           ; puts
+0009 OpGetGlobal 0
+0012 OpConstant 2             ; "you"
+0015 OpCall 1
+0017 OpCall 1
+0019 OpPop
+`
+
+	compiler := New()
+	if err := compiler.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := Disassemble(&out, compiler.Bytecode(), input); err != nil {
+		t.Fatalf("Disassemble: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("disassembly is\n%s\nwant\n%s", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := Disassemble(&out, compiler.Bytecode(), ""); err != nil {
+		t.Fatalf("Disassemble: %s", err)
+	}
+	if bytes.Contains(out.Bytes(), []byte("; 1:")) {
+		t.Errorf("disassembly without source is\n%s\nwant no source lines",
+			out.String())
+	}
+}
@@ -0,0 +1,447 @@
+package compiler // import "github.com/pto/monkey/compiler"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/pto/monkey/code"
+	"github.com/pto/monkey/object"
+)
+
+// A compiled Monkey file (.mkc) holds Bytecode in this layout:
+//
+//	magic     4 bytes "MKC\x00"
+//	version   uint16, big-endian
+//	payload   constants count, constants, instructions
+//	checksum  uint32, big-endian, CRC-32 (IEEE) of the payload
+//
+// Counts, lengths and integers in the payload are varints, as encoded by
+// encoding/binary. Each constant starts with a tag byte:
+//
+//	1 integer            value
+//	2 string             length, bytes
+//	3 compiled function  locals, parameters, instructions length, instructions
+//
+// The instructions of the main program follow the constants, as a length and
+// bytes. Source maps are not stored.
+const (
+	magic = "MKC\x00"
+
+	// FormatVersion is the version of the compiled file format written by
+	// Encode. It must be incremented whenever the layout or the meaning of
+	// the instructions changes.
+	FormatVersion = 1
+)
+
+// Tags of constants in a compiled file.
+const (
+	tagInteger  = 1
+	tagString   = 2
+	tagFunction = 3
+)
+
+// Errors returned by Decode.
+var (
+	ErrNotCompiled = errors.New("not a compiled Monkey file")
+	ErrChecksum    = errors.New("compiled file is corrupt: checksum mismatch")
+
+	errTruncated = errors.New("compiled file is corrupt: truncated")
+)
+
+// VersionError is returned by Decode for a compiled file written in another
+// version of the format.
+type VersionError struct {
+	Version int // version of the file
+}
+
+// Error describes the version mismatch.
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("compiled file has format version %d, want %d; "+
+		"rebuild it from source", e.Version, FormatVersion)
+}
+
+// IsCompiled reports whether data starts like a compiled Monkey file.
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Encode writes bytecode to w in the compiled file format.
+func Encode(w io.Writer, bytecode *Bytecode) error {
+	var payload []byte
+	payload = binary.AppendUvarint(payload, uint64(len(bytecode.Constants)))
+	for i, constant := range bytecode.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			payload = append(payload, tagInteger)
+			payload = binary.AppendVarint(payload, constant.Value)
+		case *object.String:
+			payload = append(payload, tagString)
+			payload = appendBytes(payload, []byte(constant.Value))
+		case *object.CompiledFunction:
+			payload = append(payload, tagFunction)
+			payload = binary.AppendUvarint(payload, uint64(constant.NumLocals))
+			payload = binary.AppendUvarint(payload,
+				uint64(constant.NumParameters))
+			payload = appendBytes(payload, constant.Instructions)
+		default:
+			return fmt.Errorf("constant %d: cannot encode %s", i,
+				constant.Type())
+		}
+	}
+	payload = appendBytes(payload, bytecode.Instructions)
+
+	out := []byte(magic)
+	out = binary.BigEndian.AppendUint16(out, FormatVersion)
+	out = append(out, payload...)
+	out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(payload))
+
+	_, err := w.Write(out)
+	return err
+}
+
+// appendBytes appends the length of b and b to buf.
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// Decode reads Bytecode in the compiled file format from r. It checks the
+// version and checksum of the file, and that the instructions refer only to
+// constants that exist.
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(magic) + 2
+	if !IsCompiled(data) || len(data) < headerLen {
+		return nil, ErrNotCompiled
+	}
+	version := binary.BigEndian.Uint16(data[len(magic):])
+	if version != FormatVersion {
+		return nil, &VersionError{Version: int(version)}
+	}
+	if len(data) < headerLen+4 {
+		return nil, errTruncated
+	}
+	payload := data[headerLen : len(data)-4]
+	checksum := binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, ErrChecksum
+	}
+
+	d := &decoder{data: payload}
+	bytecode := &Bytecode{}
+
+	numConstants := d.count()
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+	bytecode.Instructions = d.bytes()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("compiled file is corrupt: %d extra bytes",
+			len(d.data))
+	}
+	if err := validate(bytecode); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+// decoder reads the payload of a compiled file. After the first error, all
+// reads return zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// uvarint reads an unsigned varint.
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// count reads a count or length, which must fit in the rest of the data.
+func (d *decoder) count() int {
+	v := d.uvarint()
+	if v > uint64(len(d.data)) {
+		d.err = errTruncated
+		return 0
+	}
+	return int(v)
+}
+
+// bytes reads a length and that many bytes.
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data)
+	d.data = d.data[n:]
+	return b
+}
+
+// constant reads a tagged constant.
+func (d *decoder) constant() object.Object {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) == 0 {
+		d.err = errTruncated
+		return nil
+	}
+	tag := d.data[0]
+	d.data = d.data[1:]
+
+	switch tag {
+	case tagInteger:
+		v, n := binary.Varint(d.data)
+		if n <= 0 {
+			d.err = errTruncated
+			return nil
+		}
+		d.data = d.data[n:]
+		return &object.Integer{Value: v}
+	case tagString:
+		return &object.String{Value: string(d.bytes())}
+	case tagFunction:
+		numLocals := d.count()
+		numParameters := d.count()
+		return &object.CompiledFunction{
+			NumLocals:     numLocals,
+			NumParameters: numParameters,
+			Instructions:  d.bytes(),
+		}
+	default:
+		d.err = fmt.Errorf("compiled file is corrupt: unknown constant tag %d",
+			tag)
+		return nil
+	}
+}
+
+// validate checks that bytecode is safe to run: that all instructions
+// decode, that their operands refer to constants, builtins, locals and free
+// variables that exist, and that they use the stack consistently. Global
+// indexes need no check, since every 16-bit index has a slot in the VM.
+func validate(bytecode *Bytecode) error {
+	v := &validator{
+		constants: bytecode.Constants,
+		numFree:   make(map[int]int),
+	}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			v.numFree[i] = freeVariables(fn.Instructions)
+		}
+	}
+
+	if err := v.instructions(bytecode.Instructions, 0, true); err != nil {
+		return fmt.Errorf("compiled file is corrupt: main program: %s", err)
+	}
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.NumParameters > fn.NumLocals {
+			return fmt.Errorf("compiled file is corrupt: constant %d: "+
+				"%d parameters but %d locals", i, fn.NumParameters, fn.NumLocals)
+		}
+		if err := v.instructions(fn.Instructions, fn.NumLocals,
+			false); err != nil {
+			return fmt.Errorf("compiled file is corrupt: constant %d: %s", i,
+				err)
+		}
+	}
+	return nil
+}
+
+// validator holds the state of validate.
+type validator struct {
+	constants []object.Object
+	numFree   map[int]int // free variables used by each function constant
+}
+
+// freeVariables returns the number of free variables that ins uses: one more
+// than the largest OpGetFree operand. Instructions that do not decode are
+// left for validate to report.
+func freeVariables(ins code.Instructions) int {
+	n := 0
+	for offset := 0; offset < len(ins); {
+		_, operands, width, err := ins.Decode(offset)
+		if err != nil {
+			break
+		}
+		if code.Opcode(ins[offset]) == code.OpGetFree && operands[0] >= n {
+			n = operands[0] + 1
+		}
+		offset += width
+	}
+	return n
+}
+
+// instructions checks the instructions of a function with numLocals locals,
+// or of the main program. Jumps must go forward to the start of an
+// instruction, so the depth of the stack, relative to the locals, can be
+// followed in one pass: it must be the same however an instruction is
+// reached, and never too small for what the instruction pops.
+func (v *validator) instructions(ins code.Instructions, numLocals int,
+	main bool) error {
+	depth := make([]int, len(ins)+1) // stack depth at each offset, or -1
+	for i := range depth {
+		depth[i] = -1
+	}
+	depth[0] = 0
+	start := make([]bool, len(ins)+1) // offsets where instructions start
+	start[len(ins)] = true
+
+	reach := func(offset, d int) error {
+		if depth[offset] >= 0 && depth[offset] != d {
+			return fmt.Errorf("offset %d reached with stack depths %d and %d",
+				offset, depth[offset], d)
+		}
+		depth[offset] = d
+		return nil
+	}
+
+	for offset := 0; offset < len(ins); {
+		def, operands, width, err := ins.Decode(offset)
+		if err != nil {
+			return fmt.Errorf("offset %d: %s", offset, err)
+		}
+		start[offset] = true
+		op := code.Opcode(ins[offset])
+		if err := v.operands(op, operands, offset, len(ins), numLocals,
+			main); err != nil {
+			return fmt.Errorf("offset %d: %s: %s", offset, def.Name, err)
+		}
+
+		next := offset + width
+		if d := depth[offset]; d >= 0 {
+			pop, push := stackEffect(op, operands)
+			if d < pop {
+				return fmt.Errorf("offset %d: %s: stack underflow: needs %d "+
+					"values, has %d", offset, def.Name, pop, d)
+			}
+			d += push - pop
+
+			if op == code.OpJump || op == code.OpJumpNotTruthy {
+				if err := reach(operands[0], d); err != nil {
+					return err
+				}
+			}
+			switch op {
+			case code.OpJump, code.OpReturnValue, code.OpReturn:
+			default:
+				if err := reach(next, d); err != nil {
+					return err
+				}
+			}
+		}
+		offset = next
+	}
+
+	for offset, d := range depth {
+		if d >= 0 && !start[offset] {
+			return fmt.Errorf("offset %d: jump into the middle of an "+
+				"instruction", offset)
+		}
+	}
+	if !main && depth[len(ins)] >= 0 {
+		return fmt.Errorf("function does not end with a return")
+	}
+	return nil
+}
+
+// operands checks the operands of an instruction at offset in instructions
+// of length n.
+func (v *validator) operands(op code.Opcode, operands []int, offset, n,
+	numLocals int, main bool) error {
+	switch op {
+	case code.OpConstant:
+		if operands[0] >= len(v.constants) {
+			return fmt.Errorf("no constant %d", operands[0])
+		}
+	case code.OpClosure:
+		if operands[0] >= len(v.constants) {
+			return fmt.Errorf("no constant %d", operands[0])
+		}
+		if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+			return fmt.Errorf("constant %d is not a function", operands[0])
+		}
+		if need := v.numFree[operands[0]]; operands[1] < need {
+			return fmt.Errorf("%d free variables for a function that uses %d",
+				operands[1], need)
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		if operands[0] <= offset || operands[0] > n {
+			return fmt.Errorf("target %d out of range", operands[0])
+		}
+	case code.OpGetBuiltin:
+		if operands[0] >= len(object.Builtins) {
+			return fmt.Errorf("no builtin %d", operands[0])
+		}
+	case code.OpGetLocal, code.OpSetLocal:
+		if operands[0] >= numLocals {
+			return fmt.Errorf("no local %d", operands[0])
+		}
+	case code.OpGetFree:
+		if main {
+			return fmt.Errorf("no free variables outside a function")
+		}
+	case code.OpReturn:
+		if main {
+			return fmt.Errorf("return outside a function")
+		}
+	case code.OpHash:
+		if operands[0]%2 != 0 {
+			return fmt.Errorf("odd number of keys and values")
+		}
+	}
+	return nil
+}
+
+// stackEffect returns the number of values an instruction pops from the
+// stack and the number it pushes.
+func stackEffect(op code.Opcode, operands []int) (pop, push int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree,
+		code.OpCurrentClosure:
+		return 0, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal,
+		code.OpReturnValue:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual,
+		code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang:
+		return 1, 1
+	case code.OpArray, code.OpHash:
+		return operands[0], 1
+	case code.OpCall:
+		return operands[0] + 1, 1
+	case code.OpClosure:
+		return operands[1], 1
+	default: // OpJump, OpReturn
+		return 0, 0
+	}
+}
@@ -0,0 +1,222 @@
+package compiler // import "github.com/pto/monkey/compiler"
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pto/monkey/code"
+	"github.com/pto/monkey/object"
+)
+
+func encode(t *testing.T, input string) []byte {
+	t.Helper()
+
+	c := New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, c.Bytecode()); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeDecode(t *testing.T) {
+	input := `let big = -9223372036854775807 - 1;
+let s = "caf\u{e9}";
+let f = fn(a, b) { let c = a + b; fn() { c * 2 } };
+f(1, 2)() + len(s);`
+
+	c := New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := c.Bytecode()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, original); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+	if !IsCompiled(buf.Bytes()) {
+		t.Errorf("IsCompiled(encoded) is false, want true")
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Instructions, original.Instructions) {
+		t.Errorf("instructions are\n%s\nwant\n%s", decoded.Instructions,
+			original.Instructions)
+	}
+	if len(decoded.Constants) != len(original.Constants) {
+		t.Fatalf("len(Constants) is %d, want %d", len(decoded.Constants),
+			len(original.Constants))
+	}
+	for i, want := range original.Constants {
+		got := decoded.Constants[i]
+		switch want := want.(type) {
+		case *object.CompiledFunction:
+			fn, ok := got.(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d is %T, want *object.CompiledFunction",
+					i, got)
+				continue
+			}
+			if !bytes.Equal(fn.Instructions, want.Instructions) ||
+				fn.NumLocals != want.NumLocals ||
+				fn.NumParameters != want.NumParameters {
+				t.Errorf("constant %d is %+v, want %+v", i, fn, want)
+			}
+		default:
+			if got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+				t.Errorf("constant %d is %s %s, want %s %s", i, got.Type(),
+					got.Inspect(), want.Type(), want.Inspect())
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := encode(t, `let x = "hello"; fn(a) { a + x }(1)`)
+
+	modify := func(f func(b []byte) []byte) []byte {
+		b := append([]byte{}, valid...)
+		return f(b)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, "not a compiled Monkey file"},
+		{"source", []byte("let x = 1;"), "not a compiled Monkey file"},
+		{"version", modify(func(b []byte) []byte {
+			b[5] = FormatVersion + 1
+			return b
+		}), "compiled file has format version 2, want 1; rebuild it from source"},
+		{"checksum", modify(func(b []byte) []byte {
+			b[len(b)-1] ^= 0xff
+			return b
+		}), "compiled file is corrupt: checksum mismatch"},
+		{"payload", modify(func(b []byte) []byte {
+			b[8] ^= 0xff
+			return b
+		}), "compiled file is corrupt: checksum mismatch"},
+		{"truncated", valid[:len(valid)-6],
+			"compiled file is corrupt: checksum mismatch"},
+		{"header only", valid[:6], "compiled file is corrupt: truncated"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: Decode succeeded, want error %q", tt.name,
+				tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: error is %q, want %q", tt.name, err, tt.expected)
+		}
+	}
+
+	version := modify(func(b []byte) []byte {
+		b[4], b[5] = 0, 7
+		return b
+	})
+	_, err := Decode(bytes.NewReader(version))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.Version != 7 {
+		t.Errorf("error is %#v, want a *VersionError for version 7", err)
+	}
+}
+
+func TestDecodeInvalidInstructions(t *testing.T) {
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{&Bytecode{Instructions: []byte{0, 0, 3}},
+			"compiled file is corrupt: main program: offset 0: " +
+				"OpConstant: no constant 3"},
+		{&Bytecode{Instructions: []byte{255}},
+			"compiled file is corrupt: main program: offset 0: " +
+				"opcode 255 undefined"},
+		{&Bytecode{Constants: []object.Object{&object.CompiledFunction{
+			Instructions: []byte{0}, NumLocals: 1}}},
+			"compiled file is corrupt: constant 0: offset 0: " +
+				"OpConstant truncated"},
+		{&Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			"compiled file is corrupt: main program: offset 0: " +
+				"OpGetLocal: no local 0"},
+		{&Bytecode{Constants: []object.Object{&object.CompiledFunction{
+			Instructions: concat(code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue)), NumLocals: 1}}},
+			"compiled file is corrupt: constant 0: offset 0: " +
+				"OpGetLocal: no local 1"},
+		{&Bytecode{Instructions: code.Make(code.OpGetFree, 0)},
+			"compiled file is corrupt: main program: offset 0: " +
+				"OpGetFree: no free variables outside a function"},
+		{&Bytecode{Constants: []object.Object{&object.CompiledFunction{
+			Instructions: concat(code.Make(code.OpGetFree, 2),
+				code.Make(code.OpReturnValue))}},
+			Instructions: concat(code.Make(code.OpClosure, 0, 2),
+				code.Make(code.OpPop))},
+			"compiled file is corrupt: main program: offset 0: " +
+				"OpClosure: 2 free variables for a function that uses 3"},
+		{&Bytecode{Instructions: concat(code.Make(code.OpTrue),
+			code.Make(code.OpAdd))},
+			"compiled file is corrupt: main program: offset 1: " +
+				"OpAdd: stack underflow: needs 2 values, has 1"},
+		{&Bytecode{Instructions: concat(code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpTrue))},
+			"compiled file is corrupt: main program: " +
+				"offset 5 reached with stack depths 0 and 1"},
+		{&Bytecode{Constants: []object.Object{&object.Integer{Value: 1}},
+			Instructions: concat(code.Make(code.OpJump, 4),
+				code.Make(code.OpConstant, 0))},
+			"compiled file is corrupt: main program: " +
+				"offset 4: jump into the middle of an instruction"},
+		{&Bytecode{Instructions: concat(code.Make(code.OpNull),
+			code.Make(code.OpPop), code.Make(code.OpJump, 0))},
+			"compiled file is corrupt: main program: offset 2: " +
+				"OpJump: target 0 out of range"},
+		{&Bytecode{Instructions: code.Make(code.OpReturn)},
+			"compiled file is corrupt: main program: offset 0: " +
+				"OpReturn: return outside a function"},
+		{&Bytecode{Instructions: concat(code.Make(code.OpTrue),
+			code.Make(code.OpHash, 1))},
+			"compiled file is corrupt: main program: offset 1: " +
+				"OpHash: odd number of keys and values"},
+		{&Bytecode{Constants: []object.Object{&object.CompiledFunction{
+			Instructions: concat(code.Make(code.OpNull),
+				code.Make(code.OpPop))}}},
+			"compiled file is corrupt: constant 0: " +
+				"function does not end with a return"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tt.bytecode); err != nil {
+			t.Fatalf("Encode: %s", err)
+		}
+		_, err := Decode(&buf)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("error is %v, want %q", err, tt.expected)
+		}
+	}
+}
+
+// concat joins encoded instructions.
+func concat(instructions ...[]byte) []byte {
+	var out []byte
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package compiler // import "github.com/pto/monkey/compiler"
+
+// SymbolScope identifies where the value of a Symbol is stored at run time.
+type SymbolScope string
+
+// Enumeration of SymbolScopes.
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol is a name bound in a SymbolTable.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable records the Symbols bound in one scope of a program: the
+// globals, or the locals of one function literal.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols are the Symbols of Outer, in order of their FreeScope
+	// index, that are referred to from this scope.
+	FreeSymbols []Symbol
+
+	store          map[string]Symbol
+	numDefinitions int
+}
+
+// NewSymbolTable creates a SymbolTable for global Symbols.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable creates a SymbolTable for local Symbols, within the
+// scope of outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NumDefinitions returns the number of global or local Symbols defined.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Define binds name to the next global or local slot, replacing any previous
+// binding in the same scope.
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineBuiltin binds name to the builtin function at index.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds name to the function being compiled in this
+// scope, so that a function can refer to itself.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// defineFree binds the name of original, a Symbol of an enclosing function,
+// to the next free variable of this scope.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{
+		Name:  original.Name,
+		Index: len(s.FreeSymbols) - 1,
+		Scope: FreeScope,
+	}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve returns the Symbol bound to name in this scope or an enclosing
+// one. A local of an enclosing function is turned into a free variable of
+// this scope and of each scope in between.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	return s.defineFree(symbol), true
+}
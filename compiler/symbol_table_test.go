@@ -0,0 +1,92 @@
+package compiler // import "github.com/pto/monkey/compiler"
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	for _, got := range []Symbol{
+		global.Define("a"), global.Define("b"),
+		local.Define("c"), local.Define("d"),
+	} {
+		if got != expected[got.Name] {
+			t.Errorf("%s is %+v, want %+v", got.Name, got, expected[got.Name])
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+	first.DefineFunctionName("f")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{
+		{global, []Symbol{
+			{Name: "a", Scope: GlobalScope, Index: 0},
+			{Name: "len", Scope: BuiltinScope, Index: 0},
+		}},
+		{first, []Symbol{
+			{Name: "a", Scope: GlobalScope, Index: 0},
+			{Name: "len", Scope: BuiltinScope, Index: 0},
+			{Name: "b", Scope: LocalScope, Index: 0},
+			{Name: "f", Scope: FunctionScope, Index: 0},
+		}},
+		{second, []Symbol{
+			{Name: "a", Scope: GlobalScope, Index: 0},
+			{Name: "len", Scope: BuiltinScope, Index: 0},
+			{Name: "b", Scope: FreeScope, Index: 0},
+			{Name: "f", Scope: FreeScope, Index: 1},
+			{Name: "c", Scope: LocalScope, Index: 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, want := range tt.expected {
+			got, ok := tt.table.Resolve(want.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", want.Name)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s is %+v, want %+v", want.Name, got, want)
+			}
+		}
+	}
+
+	wantFree := []Symbol{
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "f", Scope: FunctionScope, Index: 0},
+	}
+	if len(second.FreeSymbols) != len(wantFree) {
+		t.Fatalf("len(FreeSymbols) is %d, want %d", len(second.FreeSymbols),
+			len(wantFree))
+	}
+	for i, want := range wantFree {
+		if second.FreeSymbols[i] != want {
+			t.Errorf("FreeSymbols[%d] is %+v, want %+v", i,
+				second.FreeSymbols[i], want)
+		}
+	}
+
+	if _, ok := second.Resolve("x"); ok {
+		t.Errorf("name x resolved, want unresolvable")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// edit is one line of an edit script.
+type edit struct {
+	kind byte   // ' ' for an unchanged line, '-' deleted, '+' inserted
+	text string // the line, including its newline if it has one
+}
+
+// diff returns a unified diff that changes old into new, with the headers
+// naming them oldName and newName, or "" if they are equal.
+func diff(oldName, newName string, old, new []byte) string {
+	if bytes.Equal(old, new) {
+		return ""
+	}
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	oldLine, newLine := 1, 1 // line numbers of edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Extend the hunk until a run of more than twice the context.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		if end += diffContext; end > len(edits) {
+			end = len(edits)
+		}
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, e := range edits[start:end] {
+			if e.kind != '+' {
+				oldCount++
+			}
+			if e.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount),
+			hunkRange(newStart, newCount))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		oldLine, newLine = oldStart+oldCount, newStart+newCount
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a range of lines for a hunk
+// header. An empty range starts at the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits text after each newline.
+func splitLines(text []byte) []string {
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script that changes a into b, found
+// with the linear space refinement of Myers' O(ND) difference algorithm.
+func diffLines(a, b []string) []edit {
+	size := 2*(len(a)+len(b)) + 3
+	d := &differ{forward: make([]int, size), backward: make([]int, size)}
+	d.compare(a, b)
+	return d.edits
+}
+
+// differ holds the state of diffLines. The forward and backward arrays are
+// indexed by diagonal plus offset, and reused by each level of recursion.
+type differ struct {
+	forward  []int // furthest x on each diagonal from the start
+	backward []int // furthest distance on each diagonal from the end
+	edits    []edit
+}
+
+// compare appends a shortest edit script that changes a into b.
+func (d *differ) compare(a, b []string) {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		d.edits = append(d.edits, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	n, m := len(a), len(b)
+	for n > 0 && m > 0 && a[n-1] == b[m-1] {
+		n--
+		m--
+	}
+	suffix := a[n:]
+	a, b = a[:n], b[:m]
+
+	switch {
+	case n == 0:
+		for _, line := range b {
+			d.edits = append(d.edits, edit{'+', line})
+		}
+	case m == 0:
+		for _, line := range a {
+			d.edits = append(d.edits, edit{'-', line})
+		}
+	default:
+		x, y, u, v := d.middleSnake(a, b)
+		d.compare(a[:x], b[:y])
+		for _, line := range a[x:u] {
+			d.edits = append(d.edits, edit{' ', line})
+		}
+		d.compare(a[u:], b[v:])
+	}
+
+	for _, line := range suffix {
+		d.edits = append(d.edits, edit{' ', line})
+	}
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the snake in the
+// middle of a shortest edit script for a and b, by searching from both ends
+// at once until the paths overlap. Both lists must be non-empty.
+func (d *differ) middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	offset := len(d.forward) / 2
+	d.forward[offset+1], d.backward[offset+1] = 0, 0
+
+	for step := 0; ; step++ {
+		for k := -step; k <= step; k += 2 {
+			if k == -step || k != step &&
+				d.forward[offset+k-1] < d.forward[offset+k+1] {
+				x = d.forward[offset+k+1]
+			} else {
+				x = d.forward[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			d.forward[offset+k] = u
+			if r := delta - k; odd && -step < r && r < step &&
+				u+d.backward[offset+r] >= n {
+				return x, y, u, v
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var p int
+			if k == -step || k != step &&
+				d.backward[offset+k-1] < d.backward[offset+k+1] {
+				p = d.backward[offset+k+1]
+			} else {
+				p = d.backward[offset+k-1] + 1
+			}
+			q := p - k
+			s, t := p, q
+			for s < n && t < m && a[n-s-1] == b[m-t-1] {
+				s++
+				t++
+			}
+			d.backward[offset+k] = s
+			if f := delta - k; !odd && -step <= f && f <= step &&
+				s+d.forward[offset+f] >= n {
+				return n - s, m - t, n - p, m - q
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		old, new string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nB\nc\n",
+			"--- x.orig\n+++ x\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"", "a\n", "--- x.orig\n+++ x\n@@ -0,0 +1 @@\n+a\n"},
+		{"a", "a\n", "--- x.orig\n+++ x\n@@ -1 +1 @@\n-a\n" +
+			"\\ No newline at end of file\n+a\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			"--- x.orig\n+++ x\n" +
+				"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+				"@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "1\nx\n3\n4\n5\n6\n7\ny\n",
+			"--- x.orig\n+++ x\n" +
+				"@@ -1,8 +1,8 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n"},
+	}
+
+	for _, tt := range tests {
+		got := diff("x.orig", "x", []byte(tt.old), []byte(tt.new))
+		if got != tt.expected {
+			t.Errorf("diff(%q, %q) is\n%s\nwant\n%s", tt.old, tt.new, got,
+				tt.expected)
+		}
+	}
+}
+
+// TestDiffLines checks that the edit scripts for random inputs turn one list
+// into the other, and are as short as possible.
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range diffLines(a, b) {
+			if e.kind != '+' {
+				gotA = append(gotA, e.text)
+			}
+			if e.kind != '-' {
+				gotB = append(gotB, e.text)
+			}
+			if e.kind != ' ' {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") ||
+			strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) gives %q and %q", a, b, gotA, gotB)
+		}
+		if want := len(a) + len(b) - 2*commonLength(a, b); changes != want {
+			t.Fatalf("diffLines(%q, %q) has %d changes, want %d", a, b,
+				changes, want)
+		}
+	}
+}
+
+// commonLength returns the length of the longest common subsequence of a
+// and b.
+func commonLength(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// TestDiffLinesLarge checks that a large file with every line changed is
+// diffed without using memory in proportion to the number of changes.
+func TestDiffLinesLarge(t *testing.T) {
+	const n = 10000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d\n", i)
+		b[i] = fmt.Sprintf("new %d\n", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	edits := diffLines(a, b)
+	runtime.ReadMemStats(&after)
+
+	if len(edits) != 2*n {
+		t.Fatalf("diffLines has %d edits, want %d", len(edits), 2*n)
+	}
+	for i, e := range edits {
+		if e.kind == ' ' {
+			t.Fatalf("edit %d keeps line %q, want all lines changed", i,
+				e.text)
+		}
+	}
+	const limit = 64 << 20
+	if used := after.TotalAlloc - before.TotalAlloc; used > limit {
+		t.Errorf("diffLines allocated %d bytes, want at most %d", used, limit)
+	}
+}
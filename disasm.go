@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/pto/monkey/compiler"
+)
+
+// disasmCmd implements "monkey disasm file.mk".
+func disasmCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey disasm file.mk\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	filename := flags.Arg(0)
+
+	program, src, ok := parseFile(filename, stderr)
+	if !ok {
+		return exitError
+	}
+	if program, ok = expandMacros(filename, program, stdout, stderr); !ok {
+		return exitError
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "%s: compile error: %s\n", filename, err)
+		return exitError
+	}
+
+	if err := compiler.Disassemble(stdout, c.Bytecode(), src); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
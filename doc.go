@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/pto/monkey/doc"
+)
+
+// Documentation formats.
+const (
+	docText     = "text"
+	docMarkdown = "markdown"
+	docHTML     = "html"
+)
+
+// docCmd implements "monkey doc [-format format] file.mk".
+func docCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", docText,
+		"output `format`: text, markdown or html")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey doc [-format format] file.mk\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var write func(*doc.File, io.Writer) error
+	switch *format {
+	case docText:
+		write = (*doc.File).WriteText
+	case docMarkdown:
+		write = (*doc.File).WriteMarkdown
+	case docHTML:
+		write = (*doc.File).WriteHTML
+	default:
+		fmt.Fprintf(stderr, "monkey doc: unknown format %q\n", *format)
+		flags.Usage()
+		return exitUsage
+	}
+	filename := flags.Arg(0)
+
+	program, _, ok := parseFile(filename, stderr)
+	if !ok {
+		return exitError
+	}
+
+	if err := write(doc.New(filepath.Base(filename), program),
+		stdout); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,141 @@
+// Package doc extracts documentation from Monkey source code.
+//
+// The documentation of a file lists its top-level let statements, with the
+// parameters of the functions and macros they bind. The comments on the
+// lines just before a let statement are its doc comment. A comment group at
+// the start of the file that is not the doc comment of the first statement
+// documents the file itself.
+package doc // import "github.com/pto/monkey/doc"
+
+import (
+	"strings"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/token"
+)
+
+// Kind is the kind of value bound by a let statement.
+type Kind int
+
+// Kinds of bound values.
+const (
+	Value    Kind = iota // an expression other than a literal below
+	Function             // a function literal
+	Macro                // a macro literal
+)
+
+// File is the documentation of a Monkey source file.
+type File struct {
+	Name     string // name of the file
+	Doc      string // text of the file comment, or ""
+	Bindings []*Binding
+}
+
+// Binding is the documentation of a top-level let statement.
+type Binding struct {
+	Name   string
+	Kind   Kind
+	Params []string // parameter names of a Function or Macro
+	Doc    string   // text of the doc comment, or ""
+	Pos    token.Position
+}
+
+// New returns the documentation of program, parsed from the file name.
+func New(name string, program *ast.Program) *File {
+	f := &File{Name: name}
+
+	var first ast.Statement
+	if len(program.Statements) > 0 {
+		first = program.Statements[0]
+	}
+	if len(program.Comments) > 0 {
+		g := program.Comments[0]
+		if first == nil || g.End().Offset <= first.Pos().Offset &&
+			!isDoc(first, g) {
+			f.Doc = g.Text()
+		}
+	}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		b := &Binding{
+			Name: let.Name.Value,
+			Doc:  let.Doc.Text(),
+			Pos:  let.Pos(),
+		}
+		switch value := let.Value.(type) {
+		case *ast.FunctionLiteral:
+			b.Kind, b.Params = Function, paramNames(value.Parameters)
+		case *ast.MacroLiteral:
+			b.Kind, b.Params = Macro, paramNames(value.Parameters)
+		}
+		f.Bindings = append(f.Bindings, b)
+	}
+
+	return f
+}
+
+// isDoc reports whether g is the doc comment of stmt.
+func isDoc(stmt ast.Statement, g *ast.CommentGroup) bool {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Doc == g
+	case *ast.ReturnStatement:
+		return stmt.Doc == g
+	case *ast.ExpressionStatement:
+		return stmt.Doc == g
+	}
+	return false
+}
+
+// paramNames returns the names of params.
+func paramNames(params []*ast.Identifier) []string {
+	names := []string{}
+	for _, param := range params {
+		if param != nil {
+			names = append(names, param.Value)
+		}
+	}
+	return names
+}
+
+// Signature returns the binding as it is declared, without the body of a
+// function or macro or the value of anything else, as in
+// "let add = fn(a, b)", "let unless = macro(c, t, e)" or "let pi".
+func (b *Binding) Signature() string {
+	switch b.Kind {
+	case Function:
+		return "let " + b.Name + " = fn(" + strings.Join(b.Params, ", ") + ")"
+	case Macro:
+		return "let " + b.Name + " = macro(" + strings.Join(b.Params, ", ") +
+			")"
+	}
+	return "let " + b.Name
+}
+
+// block is a paragraph of documentation text.
+type block struct {
+	Text string // lines of the paragraph, without the final newline
+	Pre  bool   // every line is indented, so it is preformatted
+}
+
+// blocks splits documentation text into paragraphs at blank lines.
+func blocks(text string) []block {
+	var out []block
+	for _, para := range strings.Split(strings.TrimRight(text, "\n"), "\n\n") {
+		if para == "" {
+			continue
+		}
+		pre := true
+		for _, line := range strings.Split(para, "\n") {
+			if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				pre = false
+			}
+		}
+		out = append(out, block{Text: para, Pre: pre})
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package doc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/parser"
+)
+
+const input = `// Package lib has helpers.
+
+// add returns the sum of a and b.
+//
+//	add(1, 2)
+let add = fn(a, b) { a + b };
+
+let unless = macro(c, t, e) { quote(if (!(unquote(c))) { unquote(t) } else { unquote(e) }) };
+
+puts("not a binding");
+
+/* pi is <about> three. */
+let pi = 3;
+let nested = fn() { let hidden = 1; hidden };
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("parser errors: %v", err)
+	}
+	return program
+}
+
+func TestNew(t *testing.T) {
+	f := New("lib.mk", parse(t, input))
+
+	if f.Name != "lib.mk" {
+		t.Errorf("Name is %q, want %q", f.Name, "lib.mk")
+	}
+	if f.Doc != "Package lib has helpers.\n" {
+		t.Errorf("Doc is %q, want %q", f.Doc, "Package lib has helpers.\n")
+	}
+
+	expected := []struct {
+		name   string
+		kind   Kind
+		params []string
+		doc    string
+		line   int
+	}{
+		{"add", Function, []string{"a", "b"},
+			"add returns the sum of a and b.\n\n\tadd(1, 2)\n", 6},
+		{"unless", Macro, []string{"c", "t", "e"}, "", 8},
+		{"pi", Value, nil, "pi is <about> three.\n", 13},
+		{"nested", Function, []string{}, "", 14},
+	}
+	if len(f.Bindings) != len(expected) {
+		t.Fatalf("got %d bindings, want %d", len(f.Bindings), len(expected))
+	}
+	for i, want := range expected {
+		b := f.Bindings[i]
+		if b.Name != want.name || b.Kind != want.kind ||
+			!reflect.DeepEqual(b.Params, want.params) || b.Doc != want.doc ||
+			b.Pos.Line != want.line {
+			t.Errorf("bindings[%d] is %q %d %q %q line %d, want %q %d %q %q "+
+				"line %d", i, b.Name, b.Kind, b.Params, b.Doc, b.Pos.Line,
+				want.name, want.kind, want.params, want.doc, want.line)
+		}
+	}
+}
+
+func TestFileDoc(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// file\n\nlet x = 1;", "file\n"},
+		{"// doc of x\nlet x = 1;", ""},
+		{"let x = 1; // trailing", ""},
+		{"// only a comment", "only a comment\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		f := New("f.mk", parse(t, tt.input))
+		if f.Doc != tt.expected {
+			t.Errorf("Doc of %q is %q, want %q", tt.input, f.Doc, tt.expected)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		binding  Binding
+		expected string
+	}{
+		{Binding{Name: "f", Kind: Function, Params: []string{"a", "b"}},
+			"let f = fn(a, b)"},
+		{Binding{Name: "f", Kind: Function}, "let f = fn()"},
+		{Binding{Name: "m", Kind: Macro, Params: []string{"x"}},
+			"let m = macro(x)"},
+		{Binding{Name: "v"}, "let v"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.binding.Signature(); got != tt.expected {
+			t.Errorf("Signature() is %q, want %q", got, tt.expected)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New("lib.mk", parse(t, input)).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Package lib has helpers.
+
+let add = fn(a, b)
+    add returns the sum of a and b.
+
+    	add(1, 2)
+
+let unless = macro(c, t, e)
+
+let pi
+    pi is <about> three.
+
+let nested = fn()
+`
+	if buf.String() != expected {
+		t.Errorf("text is\n%s\nwant\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	program := parse(t, "// File doc.\n\n// Double x.\n"+
+		"let double = fn(x) { x * 2 };\nlet y = 1;")
+	if err := New("lib.mk", program).WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# lib.mk\n\nFile doc.\n\n" +
+		"## double\n\n```monkey\nlet double = fn(x)\n```\n\nDouble x.\n\n" +
+		"## y\n\n```monkey\nlet y\n```\n"
+	if buf.String() != expected {
+		t.Errorf("markdown is\n%s\nwant\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New("<lib>.mk", parse(t, input)).WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	html := buf.String()
+	for _, want := range []string{
+		"<title>&lt;lib&gt;.mk</title>",
+		"<p>Package lib has helpers.</p>",
+		`<h2 id="add">add</h2>`,
+		"<pre><code>let add = fn(a, b)</code></pre>",
+		"<p>add returns the sum of a and b.</p>\n<pre>\tadd(1, 2)</pre>",
+		"<p>pi is &lt;about&gt; three.</p>",
+		`<h2 id="nested">nested</h2>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, html)
+		}
+	}
+}
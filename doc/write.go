@@ -0,0 +1,83 @@
+package doc // import "github.com/pto/monkey/doc"
+
+import (
+	"bufio"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteText writes the documentation as plain text: the file comment, then
+// the signature of each binding followed by its doc comment, indented.
+func (f *File) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	sep := ""
+	if f.Doc != "" {
+		bw.WriteString(f.Doc)
+		sep = "\n"
+	}
+	for _, b := range f.Bindings {
+		bw.WriteString(sep + b.Signature() + "\n")
+		for _, line := range strings.SplitAfter(b.Doc, "\n") {
+			if line != "\n" && line != "" {
+				bw.WriteString("    ")
+			}
+			bw.WriteString(line)
+		}
+		sep = "\n"
+	}
+	return bw.Flush()
+}
+
+// WriteMarkdown writes the documentation as Markdown, with a heading for
+// the file and one for each binding. Doc comments are copied as they are,
+// so they can use Markdown themselves.
+func (f *File) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# " + f.Name + "\n")
+	if f.Doc != "" {
+		bw.WriteString("\n" + f.Doc)
+	}
+	for _, b := range f.Bindings {
+		bw.WriteString("\n## " + b.Name + "\n\n")
+		bw.WriteString("```monkey\n" + b.Signature() + "\n```\n")
+		if b.Doc != "" {
+			bw.WriteString("\n" + b.Doc)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteHTML writes the documentation as an HTML page, with a heading for the
+// file and one for each binding, whose id is the name of the binding. Each
+// paragraph of a doc comment becomes a p element, or a pre element if all
+// its lines are indented.
+func (f *File) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, f)
+}
+
+var htmlTemplate = template.Must(template.New("html").Funcs(
+	template.FuncMap{"blocks": blocks},
+).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{template "doc" .Doc}}
+{{- range .Bindings}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<pre><code>{{.Signature}}</code></pre>
+{{template "doc" .Doc}}
+{{- end}}
+</body>
+</html>
+{{define "doc"}}
+{{- range blocks .}}
+{{- if .Pre}}<pre>{{.Text}}</pre>
+{{else}}<p>{{.Text}}</p>
+{{end}}
+{{- end}}
+{{- end}}`))
@@ -0,0 +1,449 @@
+// Package evaluator is a tree-walking interpreter for the Monkey programming
+// language.
+package evaluator // import "github.com/pto/monkey/evaluator"
+
+import (
+	"fmt"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/object"
+)
+
+// Singleton values for objects that carry no state of their own.
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// Eval evaluates node in env and returns the resulting Object.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+		return nil
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body,
+			Env: env}
+	case *ast.MacroLiteral:
+		return newError("macro literal outside a top-level let statement")
+	case *ast.CallExpression:
+		if isCallOf(node, "quote") {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments: got %d, want 1",
+					len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function, args, env)
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	}
+
+	if node == nil {
+		return newError("missing expression")
+	}
+	return newError("unsupported node: %T", node)
+}
+
+// evalProgram evaluates each statement of program in turn, stopping early at
+// a return statement or an error.
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement evaluates each statement of block in turn. Unlike
+// evalProgram, it leaves return values wrapped so that they unwind through
+// any enclosing blocks.
+func evalBlockStatement(block *ast.BlockStatement,
+	env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURNVALUE || rt == object.ERROR {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// evalIdentifier returns the value bound to an identifier, or the builtin
+// function of that name.
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+	return newError("identifier not found: %s", node.Value)
+}
+
+// evalExpressions evaluates exps from left to right. If one of them is an
+// error, it returns just that error.
+func evalExpressions(exps []ast.Expression,
+	env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// MaxCallDepth is the number of function calls that can be active at once.
+const MaxCallDepth = 1024
+
+// applyFunction calls fn with args from env. A Function's body is evaluated
+// in a new Environment, enclosed by the one the Function captured, in which
+// each parameter is bound to its argument. A Builtin writes to the output of
+// env.
+func applyFunction(fn object.Object, args []object.Object,
+	env *object.Environment) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: got %d, want %d",
+				len(args), len(fn.Parameters))
+		}
+		if env.Depth() >= MaxCallDepth {
+			return newError("call stack overflow")
+		}
+		env := object.NewCallEnvironment(fn.Env, env)
+		for i, param := range fn.Parameters {
+			env.Set(param.Value, args[i])
+		}
+		evaluated := Eval(fn.Body, env)
+		return unwrapReturnValue(evaluated)
+	case *object.Builtin:
+		if result := fn.Fn(env.Output(), args...); result != nil {
+			return result
+		}
+		return NULL
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+// unwrapReturnValue returns the value of a ReturnValue, so that a return
+// unwinds no further than the function that executes it. A function whose
+// body produces no value returns NULL.
+func unwrapReturnValue(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case nil:
+		return NULL
+	}
+	return obj
+}
+
+// evalIndexExpression returns the element of left selected by index.
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s[%s]",
+			left.Type(), index.Type())
+	}
+}
+
+// evalArrayIndexExpression returns the element of an array at index, or NULL
+// if index is out of range.
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+	i := index.(*object.Integer).Value
+
+	if i < 0 || i >= int64(len(elements)) {
+		return NULL
+	}
+	return elements[i]
+}
+
+// evalPrefixExpression applies a prefix operator to its operand.
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// evalBangOperatorExpression negates the truthiness of right.
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
+// evalMinusPrefixOperatorExpression negates an integer.
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER {
+		return newError("unknown operator: -%s", right.Type())
+	}
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
+}
+
+// evalInfixExpression applies an infix operator to its operands.
+func evalInfixExpression(operator string,
+	left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
+		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING && right.Type() == object.STRING:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalIntegerInfixExpression applies an infix operator to two integers.
+func evalIntegerInfixExpression(operator string,
+	left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalIfExpression evaluates the consequence or alternative of an if
+// expression, depending on the truthiness of its condition. It returns NULL
+// if the condition is false and there is no alternative.
+func evalIfExpression(ie *ast.IfExpression,
+	env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	var result object.Object
+	switch {
+	case isTruthy(condition):
+		result = Eval(ie.Consequence, env)
+	case ie.Alternative != nil:
+		result = Eval(ie.Alternative, env)
+	}
+	if result == nil { // no branch, or one that is empty or ends in a let
+		return NULL
+	}
+	return result
+}
+
+// evalStringInfixExpression applies an infix operator to two strings.
+func evalStringInfixExpression(operator string,
+	left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalHashLiteral evaluates the keys and values of a hash literal, in source
+// order, into a Hash.
+func evalHashLiteral(node *ast.HashLiteral,
+	env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// evalHashIndexExpression returns the value stored in a hash under index, or
+// NULL if there is none.
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hash.(*object.Hash).Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+// nativeBoolToBooleanObject returns the TRUE or FALSE singleton.
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// isTruthy returns false for null and false, and true for everything else.
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// isError reports whether obj is an Error.
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR
+}
+
+// newError creates an Error with a formatted message.
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
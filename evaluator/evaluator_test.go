@@ -0,0 +1,666 @@
+package evaluator // import "github.com/pto/monkey/evaluator"
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"3 * 3 * 3 + 10", 37},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"1 < 2 == 2 > 1", true},
+		{"1 < 2 != 2 > 1", false},
+		{"1 > 2 == 2 > 1", false},
+		{"true", true},
+		{"false", false},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!5", false},
+		{"!!5", true},
+		{"!-5", false},
+		{"!!-5", true},
+		{"!true", false},
+		{"!false", true},
+		{"!!true", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) {}", nil},
+		{"if (false) { 10 } else {}", nil},
+		{"if (true) { let x = 1 }", nil},
+		{"puts(if (true) { let x = 1 })", nil},
+		{"let a = if (true) { let x = 1 }; puts(a)", nil},
+		{"let a = if (true) { let x = 1 }; a", nil},
+		{"if (true) {} == 1", "type mismatch: NULL == INTEGER"},
+		{"-if (true) { let z = 1 }", "unknown operator: -NULL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: evaluated is %T (%+v), want *object.Error",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: errObj.Message is %q, want %q", tt.input,
+					errObj.Message, expected)
+			}
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(t, input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("evaluated is %T (%+v), want *object.Function", evaluated,
+			evaluated)
+	}
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("len(fn.Parameters) is %d, want 1", len(fn.Parameters))
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("fn.Parameters[0] is %q, want \"x\"", fn.Parameters[0])
+	}
+	if fn.Body.String() != "(x + 2)" {
+		t.Fatalf("fn.Body is %q, want \"(x + 2)\"", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn() { return 1; 2 }; f() + 10", 11},
+		{"let x = 1; let f = fn(x) { x * 10 }; f(2) + x", 21},
+		{`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+		fib(15)`, 610},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFunctionWithoutValue(t *testing.T) {
+	testNullObject(t, testEval(t, "let f = fn() { }; f()"))
+	testNullObject(t, testEval(t, "let f = fn() { let x = 1; }; f()"))
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let newAdder = fn(x) { fn(y) { x + y }; };
+		let addTwo = newAdder(2);
+		addTwo(2);`, 4},
+		{`let newAdder = fn(x) { fn(y) { x + y }; };
+		let addTwo = newAdder(2);
+		let addTen = newAdder(10);
+		addTwo(1) + addTen(1);`, 14},
+		{`let add = fn(a) { fn(b) { fn(c) { a + b + c } } };
+		add(1)(2)(3);`, 6},
+		{`let compose = fn(f, g) { fn(x) { g(f(x)) } };
+		let inc = fn(x) { x + 1 };
+		let double = fn(x) { x * 2 };
+		compose(inc, double)(5);`, 12},
+		{`let makeCounter = fn(n) { fn() { [n, makeCounter(n + 1)] } };
+		let counter = makeCounter(0);
+		let step = fn(c) { c()[1] };
+		let third = step(step(step(counter)));
+		third()[0] + counter()[0];`, 3},
+		{`let x = 10;
+		let getX = fn() { x };
+		let shadow = fn(x) { getX() };
+		shadow(99);`, 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn() { f() }; f()", "call stack overflow"},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(1023)", 0},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(1024)",
+			"call stack overflow"},
+		{`let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } };
+		f(1023); f(1023); f(1023)`, 0},
+		{`let newCaller = fn() { fn() { newCaller()() } };
+		newCaller()()`, "call stack overflow"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: evaluated is %T (%+v), want *object.Error",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: errObj.Message is %q, want %q", tt.input,
+					errObj.Message, expected)
+			}
+		}
+	}
+}
+
+func TestHigherOrderFunctions(t *testing.T) {
+	prelude := `
+		let map = fn(arr, f) {
+			let iter = fn(arr, accumulated) {
+				if (len(arr) == 0) {
+					accumulated
+				} else {
+					iter(rest(arr), push(accumulated, f(first(arr))));
+				}
+			};
+			iter(arr, []);
+		};
+		let reduce = fn(arr, initial, f) {
+			let iter = fn(arr, result) {
+				if (len(arr) == 0) {
+					result
+				} else {
+					iter(rest(arr), f(result, first(arr)));
+				}
+			};
+			iter(arr, initial);
+		};
+		let sum = fn(arr) { reduce(arr, 0, fn(a, b) { a + b }) };
+	`
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"sum([1, 2, 3, 4, 5])", 15},
+		{"sum(map([1, 2, 3], fn(x) { x * x }))", 14},
+		{"len(map([], fn(x) { x }))", 0},
+		{"let n = 10; sum(map([1, 2], fn(x) { x * n }))", 30},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, prelude+tt.input), tt.expected)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("evaluated is %T (%+v), want *object.String", evaluated,
+			evaluated)
+	}
+	if str.Value != "Hello World!" {
+		t.Errorf("str.Value is %q, want %q", str.Value, "Hello World!")
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!\n"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("evaluated is %T (%+v), want *object.String", evaluated,
+			evaluated)
+	}
+	if str.Value != "Hello World!\n" {
+		t.Errorf("str.Value is %q, want %q", str.Value, "Hello World!\n")
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("evaluated is %T (%+v), want *object.Array", evaluated,
+			evaluated)
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("len(result.Elements) is %d, want 3", len(result.Elements))
+	}
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+		{"[][0]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("evaluated is %T (%+v), want *object.Hash", evaluated,
+			evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("len(result.Pairs) is %d, want %d", len(result.Pairs),
+			len(expected))
+	}
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for key %+v", expectedKey)
+			continue
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+
+	want := `{false: 6, true: 5, 4: 4, one: 1, three: 3, two: 2}`
+	if result.Inspect() != want {
+		t.Errorf("result.Inspect() is %q, want %q", result.Inspect(), want)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{1: 5, 1: 6}[1]`, 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: got 2, want 1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([1])`, []int{}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`let a = [1]; push(a, 2); a`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`push([1])`, "wrong number of arguments: got 1, want 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: evaluated is %T (%+v), want *object.Error",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: errObj.Message is %q, want %q", tt.input,
+					errObj.Message, expected)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: evaluated is %T (%+v), want *object.Array",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: len(array.Elements) is %d, want %d", tt.input,
+					len(array.Elements), len(expected))
+				continue
+			}
+			for i, want := range expected {
+				testIntegerObject(t, array.Elements[i], int64(want))
+			}
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	input := `let f = fn(x) { puts(x) }; puts("hello", 1 + 2); f([1, "a"])`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetOutput(&out)
+	evaluated := Eval(program, env)
+	testNullObject(t, evaluated)
+
+	want := "hello\n3\n[1, a]\n"
+	if out.String() != want {
+		t.Errorf("output is %q, want %q", out.String(), want)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5\nlet b = a * 2\nb", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"let x = 5; return x * 2; 99", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 < 2 == 5", "type mismatch: BOOLEAN == INTEGER"},
+		{"1 < 2 == 5; 5", "type mismatch: BOOLEAN == INTEGER"},
+		{"-!5", "unknown operator: -BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }",
+			"unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }",
+			"unknown operator: BOOLEAN + BOOLEAN"},
+		{"!1 + !2", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; !1 * !2; 5", "unknown operator: BOOLEAN * BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"1 / 0", "division by zero"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{"1[0]", "index operator not supported: INTEGER[INTEGER]"},
+		{`[1][true]`, "index operator not supported: ARRAY[BOOLEAN]"},
+		{"5(1)", "not a function: INTEGER"},
+		{`{"name": "Monkey"}[[1]];`, "unusable as hash key: ARRAY"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`{{}: 2}`, "unusable as hash key: HASH"},
+		{`{"a": 1}[{}]`, "unusable as hash key: HASH"},
+		{`{"a": x}`, "identifier not found: x"},
+		{`{fn(x) { x }: 1}`, "unusable as hash key: FUNCTION"},
+		{`{1: 2}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: got 2, want 1"},
+		{"let f = fn() { y }; f()", "identifier not found: y"},
+		{"[1, foo]", "identifier not found: foo"},
+		{"len(1, bar)", "identifier not found: bar"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: evaluated is %T (%+v), want *object.Error",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: errObj.Message is %q, want %q",
+				tt.input, errObj.Message, tt.expectedMessage)
+		}
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("%q: parser errors: %v", input, err)
+	}
+	env := object.NewEnvironment()
+	env.SetOutput(io.Discard)
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("obj is %T (%+v), want *object.Integer", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("result.Value is %d, want %d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("obj is %T (%+v), want *object.Boolean", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("result.Value is %t, want %t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("obj is %T (%+v), want NULL", obj, obj)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package evaluator // import "github.com/pto/monkey/evaluator"
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/object"
+)
+
+// DefineMacros removes the macro definitions, top-level let statements
+// binding macro literals, from program and binds each macro in env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: macro.Parameters,
+			Body:       macro.Body,
+			Env:        env,
+		})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces each call of a macro bound in env within program by
+// the AST the macro returns. The arguments of a macro are passed to it
+// unevaluated, as Quotes, and it must return a Quote. Macro calls in the
+// arguments of a call are expanded first.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("wrong number of arguments: got %d, want %d",
+				len(call.Arguments), len(macro.Parameters))
+			return node
+		}
+
+		evalEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			evalEnv.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+		}
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		switch evaluated := evaluated.(type) {
+		case *object.Quote:
+			return evaluated.Node
+		case *object.Error:
+			err = errors.New(evaluated.Message)
+		default:
+			err = fmt.Errorf("macro %s returned %s, want QUOTE",
+				call.Function, evaluated.Type())
+		}
+		return node
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// macroOf returns the Macro called by call, if it calls one bound in env.
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
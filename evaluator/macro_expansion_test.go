@@ -0,0 +1,149 @@
+package evaluator // import "github.com/pto/monkey/evaluator"
+
+import (
+	"testing"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/parser"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(t, input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("len(program.Statements) is %d, want 2",
+			len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("obj is %T (%+v), want *object.Macro", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("len(macro.Parameters) is %d, want 2",
+			len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("macro.Parameters[0] is %q, want \"x\"", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("macro.Parameters[1] is %q, want \"y\"", macro.Parameters[1])
+	}
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("macro.Body is %q, want \"(x + y)\"", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();`,
+			"(1 + 2)",
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);`,
+			"(10 - 5) - (2 + 2)",
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`let twice = macro(x) { return quote([unquote(x), unquote(x)]); };
+			let y = twice(twice(1));`,
+			"let y = [[1, 1], [1, 1]];",
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(t, tt.expected)
+		program := testParseProgram(t, tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("%q: ExpandMacros: %s", tt.input, err)
+			continue
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("%q: expanded is %q, want %q", tt.input,
+				expanded.String(), expected.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let m = macro(x) { quote(x) }; m()",
+			"wrong number of arguments: got 0, want 1"},
+		{"let m = macro() { 1 }; m()", "macro m returned INTEGER, want QUOTE"},
+		{"let m = macro() { }; m()", "macro m returned NULL, want QUOTE"},
+		{"let m = macro() { 1 + true }; m()",
+			"type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(t, tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("%q: ExpandMacros succeeded, want error %q", tt.input,
+				tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: error is %q, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func testParseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("%q: parser errors: %v", input, err)
+	}
+	return program
+}
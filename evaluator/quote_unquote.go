@@ -0,0 +1,79 @@
+package evaluator // import "github.com/pto/monkey/evaluator"
+
+import (
+	"fmt"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/token"
+)
+
+// quote returns a Quote of node, in which each call of unquote is replaced
+// by the AST of its evaluated argument. The node itself is left unchanged,
+// since it may be quoted again with different values.
+func quote(node ast.Node, env *object.Environment) object.Object {
+	var err object.Object
+
+	quoted := ast.Modify(ast.Copy(node), func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if err != nil || !ok || !isCallOf(call, "unquote") {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments: got %d, want 1",
+				len(call.Arguments))
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if isError(unquoted) {
+			err = unquoted
+			return node
+		}
+		converted := convertObjectToASTNode(unquoted, call)
+		if converted == nil {
+			err = newError("unquote of %s not supported", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: quoted}
+}
+
+// isCallOf reports whether call calls the function called name.
+func isCallOf(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// convertObjectToASTNode returns an AST node that evaluates to obj, placed
+// at the position of the unquote call it replaces, or nil if there is none.
+func convertObjectToASTNode(obj object.Object, call *ast.CallExpression) ast.Node {
+	tok := token.Token{Pos: call.Pos(), End: call.End()}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok.Type = token.INT
+		tok.Literal = fmt.Sprintf("%d", obj.Value)
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}
+	case *object.Boolean:
+		if obj.Value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		} else {
+			tok.Type, tok.Literal = token.FALSE, "false"
+		}
+		return &ast.Boolean{Token: tok, Value: obj.Value}
+	case *object.String:
+		tok.Type = token.STRING
+		tok.Literal = obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}
+	case *object.Quote:
+		return ast.Copy(obj.Node)
+	default:
+		return nil
+	}
+}
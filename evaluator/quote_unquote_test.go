@@ -0,0 +1,100 @@
+package evaluator // import "github.com/pto/monkey/evaluator"
+
+import (
+	"testing"
+
+	"github.com/pto/monkey/object"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote(5)", "5"},
+		{"quote(5 + 8)", "(5 + 8)"},
+		{"quote(foobar)", "foobar"},
+		{"quote(foobar + barfoo)", "(foobar + barfoo)"},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote(unquote(4))", "4"},
+		{"quote(unquote(4 + 4))", "8"},
+		{"quote(8 + unquote(4 + 4))", "(8 + 8)"},
+		{"quote(unquote(4 + 4) + 8)", "(8 + 8)"},
+		{"let foobar = 8; quote(foobar)", "foobar"},
+		{"let foobar = 8; quote(unquote(foobar))", "8"},
+		{"quote(unquote(true))", "true"},
+		{"quote(unquote(true == false))", "false"},
+		{`quote(unquote("a" + "b"))`, `"ab"`},
+		{"quote(unquote(quote(4 + 4)))", "(4 + 4)"},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+			"(8 + (4 + 4))"},
+		{`let f = fn(x) { quote(unquote(x) + 1) };
+		f(1); f(2)`, "(2 + 1)"},
+		{"quote([unquote(1), {unquote(2): fn(x) { unquote(3) }}])",
+			"[1, {2:fn(x) 3}]"},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote()", "wrong number of arguments: got 0, want 1"},
+		{"quote(1, 2)", "wrong number of arguments: got 2, want 1"},
+		{"quote(unquote())", "wrong number of arguments: got 0, want 1"},
+		{"quote(unquote(x))", "identifier not found: x"},
+		{"quote(unquote([1]))", "unquote of ARRAY not supported"},
+		{"macro(x) { x }", "macro literal outside a top-level let statement"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: evaluated is %T (%+v), want *object.Error",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: errObj.Message is %q, want %q", tt.input,
+				errObj.Message, tt.expected)
+		}
+	}
+}
+
+func testQuoteObject(t *testing.T, input string, obj object.Object,
+	expected string) {
+	t.Helper()
+
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("%q: evaluated is %T (%+v), want *object.Quote", input, obj,
+			obj)
+		return
+	}
+	if quote.Node == nil {
+		t.Errorf("%q: quote.Node is nil", input)
+		return
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("%q: quote.Node is %q, want %q", input, quote.Node.String(),
+			expected)
+	}
+}
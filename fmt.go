@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pto/monkey/format"
+	"github.com/pto/monkey/parser"
+)
+
+// fmtCmd implements "monkey fmt [-w] [-d] [file.mk ...]".
+func fmtCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false,
+		"write the result to the source file instead of standard output")
+	showDiff := flags.Bool("d", false,
+		"write diffs instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey fmt [-w] [-d] [file.mk ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(stderr, "monkey fmt: cannot use -w with standard input\n")
+			flags.Usage()
+			return exitUsage
+		}
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return exitError
+		}
+		if !formatFile("<stdin>", src, false, *showDiff, stdout, stderr) {
+			return exitError
+		}
+		return exitOK
+	}
+
+	code := exitOK
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			code = exitError
+			continue
+		}
+		if !formatFile(filename, src, *write, *showDiff, stdout, stderr) {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// formatFile formats src, read from filename. The result replaces the file
+// if write is set; a diff of the changes is written to stdout if showDiff is
+// set; otherwise the result is written to stdout. Any errors are written to
+// stderr, in which case ok is false.
+func formatFile(filename string, src []byte, write, showDiff bool,
+	stdout, stderr io.Writer) bool {
+	res, err := format.Source(src)
+	if err != nil {
+		if list, isList := err.(parser.ErrorList); isList {
+			for _, e := range list {
+				e.Pos.Filename = filename
+			}
+		}
+		parser.PrintError(stderr, string(src), err)
+		return false
+	}
+
+	if showDiff {
+		fmt.Fprint(stdout, diff(filename+".orig", filename, src, res))
+	}
+	if write {
+		if bytes.Equal(src, res) {
+			return true
+		}
+		if err := writeFile(filename, res); err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return false
+		}
+	}
+	if !write && !showDiff {
+		stdout.Write(res)
+	}
+	return true
+}
+
+// writeFile replaces the contents of an existing file, keeping its mode.
+func writeFile(filename string, data []byte) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, fi.Mode().Perm())
+}
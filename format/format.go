@@ -0,0 +1,521 @@
+// Package format implements canonical formatting of Monkey source code.
+//
+// Formatted source has one statement per line, blocks indented by one tab,
+// and single spaces around infix operators and after commas and colons.
+// Parentheses are written only where the parser needs them to rebuild the
+// same tree. Blank lines between statements are kept, but runs of them are
+// reduced to one. Array and hash literals that span several lines in the
+// source are written with one element per line.
+//
+// The comments of a Program are kept. A comment that follows other source
+// on its line stays at the end of that line; other comments get lines of
+// their own. A "/* */" comment within an expression stays in place if it
+// fits on one line.
+package format // import "github.com/pto/monkey/format"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/parser"
+	"github.com/pto/monkey/token"
+)
+
+// Source formats the Monkey source code src, keeping a "#!" line at the
+// start. If src has syntax errors, it returns them as a parser.ErrorList.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if bytes.HasPrefix(src, []byte("#!")) {
+		line := src
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			line = src[:i]
+		}
+		buf.Write(bytes.TrimRight(line, "\r"))
+		buf.WriteByte('\n')
+	}
+	if err := Node(&buf, program); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Node writes the canonical source of node to w. A Program is followed by a
+// newline, and its comments are written too; other nodes are written
+// without comments or a newline. Node returns an error if the tree contains
+// a BadStatement, a BadExpression or a missing child node.
+func Node(w io.Writer, node ast.Node) error {
+	p := &printer{}
+	switch n := node.(type) {
+	case *ast.Program:
+		for _, g := range n.Comments {
+			p.comments = append(p.comments, g.List...)
+		}
+		p.statements(n.Statements, false)
+		p.flush(token.Position{})
+		if p.out.Len() > 0 {
+			p.newline()
+		}
+	case ast.Statement:
+		p.statement(n, nil, false)
+	case ast.Expression:
+		p.expression(n, lowest)
+	default:
+		p.errorf(node)
+	}
+	if p.err != nil {
+		return p.err
+	}
+
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+// Precedence levels of expressions, beyond those of the infix operators.
+var (
+	lowest = parser.Precedence(token.EOF)
+	prefix = int(parser.PREFIX)
+	call   = int(parser.CALL)
+	atom   = int(parser.INDEX) + 1 // literals and identifiers
+)
+
+// printer holds the state of Node.
+type printer struct {
+	out      bytes.Buffer
+	indent   int
+	comments []*ast.Comment // comments to write, in source order
+	next     int            // index of the next comment to write
+	last     token.Position // source end of the last node written, if known
+	err      error
+}
+
+// errorf records an error for a node that cannot be formatted.
+func (p *printer) errorf(node ast.Node) {
+	if p.err != nil {
+		return
+	}
+	if node == nil {
+		p.err = fmt.Errorf("format: missing node")
+		return
+	}
+	p.err = fmt.Errorf("format: %s: cannot format %T", node.Pos(), node)
+}
+
+// print writes s.
+func (p *printer) print(s string) {
+	p.out.WriteString(s)
+}
+
+// newline ends the current line and indents the next one.
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+}
+
+// lineBreak starts a new line for source at pos, after writing the comments
+// before it. The new line is preceded by a blank line if the source has one.
+func (p *printer) lineBreak(pos token.Position) {
+	p.flush(pos)
+	if p.out.Len() == 0 {
+		return
+	}
+	if p.last.IsValid() && pos.IsValid() && pos.Line > p.last.Line+1 {
+		p.out.WriteByte('\n')
+	}
+	p.newline()
+}
+
+// flush writes the comments before pos, or all the remaining comments if
+// pos is invalid. A comment on the line where the last node written ends
+// follows it on the output line; the others start new lines, except that
+// "/* */" comments on the line of pos are left for inline.
+func (p *printer) flush(pos token.Position) {
+	for ; p.next < len(p.comments); p.next++ {
+		c := p.comments[p.next]
+		if pos.IsValid() && c.Slash.Offset >= pos.Offset {
+			return
+		}
+		trailing := p.last.IsValid() && c.Slash.Line == p.last.Line
+		if !trailing && c.Slash.Line == pos.Line && isInline(c) {
+			return
+		}
+		switch {
+		case p.out.Len() == 0:
+		case trailing:
+			p.print(" ")
+		default:
+			if p.last.IsValid() && c.Slash.Line > p.last.Line+1 {
+				p.out.WriteByte('\n')
+			}
+			p.newline()
+		}
+		p.print(c.Text)
+		if !p.last.IsValid() || c.Slash.Offset > p.last.Offset {
+			p.last = c.End() // not a comment moved out of an expression
+		}
+	}
+}
+
+// inline writes the "/* */" comments before pos that fit on one line, each
+// followed by a space. It stops at any other comment, which waits for the
+// next line break.
+func (p *printer) inline(pos token.Position) {
+	for ; p.next < len(p.comments); p.next++ {
+		c := p.comments[p.next]
+		if !pos.IsValid() || c.Slash.Offset >= pos.Offset || !isInline(c) {
+			return
+		}
+		p.print(c.Text + " ")
+	}
+}
+
+// isInline reports whether c is a "/* */" comment on one line.
+func isInline(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "/*") && !strings.Contains(c.Text, "\n")
+}
+
+// commentBefore reports whether a comment that has not been written comes
+// before pos.
+func (p *printer) commentBefore(pos token.Position) bool {
+	return p.next < len(p.comments) && pos.IsValid() &&
+		p.comments[p.next].Slash.Offset < pos.Offset
+}
+
+// start returns the position of node, or an invalid position if node is nil.
+func start(node ast.Node) token.Position {
+	if node == nil {
+		return token.Position{}
+	}
+	return node.Pos()
+}
+
+// end returns the end position of node, or an invalid position if node is
+// nil.
+func end(node ast.Node) token.Position {
+	if node == nil {
+		return token.Position{}
+	}
+	return node.End()
+}
+
+// multiline reports whether the source of a list ending at close starts its
+// first element on a later line than node.
+func multiline(node ast.Node, first ast.Node, close token.Position) bool {
+	open := node.Pos()
+	return open.IsValid() && close.IsValid() && first != nil &&
+		first.Pos().Line > open.Line
+}
+
+// statements writes a list of statements, one per line. In a block, the
+// last expression statement needs no semicolon.
+func (p *printer) statements(list []ast.Statement, inBlock bool) {
+	for i, stmt := range list {
+		var next ast.Statement
+		if i+1 < len(list) {
+			next = list[i+1]
+		}
+		p.lineBreak(start(stmt))
+		p.statement(stmt, next, inBlock)
+		p.last = end(stmt)
+	}
+}
+
+// statement writes stmt, which is followed by next, or by nothing if next
+// is nil.
+func (p *printer) statement(stmt ast.Statement, next ast.Statement,
+	inBlock bool) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		if s.Name == nil || s.Value == nil {
+			p.errorf(s)
+			return
+		}
+		p.inline(s.Pos())
+		p.print("let " + s.Name.Value + " = ")
+		p.expression(s.Value, lowest)
+		p.print(";")
+	case *ast.ReturnStatement:
+		if s.ReturnValue == nil {
+			p.errorf(s)
+			return
+		}
+		p.inline(s.Pos())
+		p.print("return ")
+		p.expression(s.ReturnValue, lowest)
+		p.print(";")
+	case *ast.ExpressionStatement:
+		if s.Expression == nil {
+			p.errorf(s)
+			return
+		}
+		p.expression(s.Expression, lowest)
+		if needsSemicolon(s, next, inBlock) {
+			p.print(";")
+		}
+	default:
+		p.errorf(stmt)
+	}
+}
+
+// needsSemicolon reports whether an expression statement must end with a
+// semicolon. One is written after every expression statement except the
+// last one of a block, whose value is the value of the block, and an if
+// expression, unless the next statement could be read as continuing it.
+func needsSemicolon(stmt *ast.ExpressionStatement,
+	next ast.Statement, inBlock bool) bool {
+	if next == nil {
+		return !inBlock && !isIf(stmt.Expression)
+	}
+	if !isIf(stmt.Expression) {
+		return true
+	}
+	es, ok := next.(*ast.ExpressionStatement)
+	return ok && continues(es.Expression, lowest)
+}
+
+// isIf reports whether x is an if expression.
+func isIf(x ast.Expression) bool {
+	_, ok := x.(*ast.IfExpression)
+	return ok
+}
+
+// continues reports whether x, written as an operand needing precedence
+// level min, starts with a token that would continue a preceding expression:
+// a minus sign, a left parenthesis or a left bracket.
+func continues(x ast.Expression, min int) bool {
+	if precedenceOf(x) < min {
+		return true
+	}
+	switch x := x.(type) {
+	case *ast.PrefixExpression:
+		return x.Operator == "-"
+	case *ast.InfixExpression:
+		return continues(x.Left, parser.Precedence(token.Type(x.Operator)))
+	case *ast.CallExpression:
+		return continues(x.Function, call)
+	case *ast.IndexExpression:
+		return continues(x.Left, call)
+	case *ast.ArrayLiteral:
+		return true
+	}
+	return false
+}
+
+// precedenceOf returns the precedence level of x: the lowest level of an
+// operator that can take x as an operand without parentheses.
+func precedenceOf(x ast.Expression) int {
+	switch x := x.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.Type(x.Operator))
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.IndexExpression:
+		return call
+	}
+	return atom
+}
+
+// expression writes x, in parentheses if its precedence level is lower than
+// min.
+func (p *printer) expression(x ast.Expression, min int) {
+	if x == nil {
+		p.errorf(nil)
+		return
+	}
+	p.inline(x.Pos())
+	if precedenceOf(x) < min {
+		p.print("(")
+		defer p.print(")")
+	}
+
+	switch x := x.(type) {
+	case *ast.Identifier:
+		p.print(x.Value)
+	case *ast.IntegerLiteral:
+		if x.Token.Literal != "" {
+			p.print(x.Token.Literal)
+		} else {
+			p.print(strconv.FormatInt(x.Value, 10))
+		}
+	case *ast.StringLiteral:
+		p.print(ast.Quote(x.Value))
+	case *ast.Boolean:
+		p.print(strconv.FormatBool(x.Value))
+	case *ast.PrefixExpression:
+		p.print(x.Operator)
+		p.expression(x.Right, prefix)
+	case *ast.InfixExpression:
+		level := parser.Precedence(token.Type(x.Operator))
+		p.expression(x.Left, level)
+		p.print(" ")
+		p.inline(x.Token.Pos)
+		p.print(x.Operator + " ")
+		p.expression(x.Right, level+1)
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expression(x.Condition, lowest)
+		p.print(") ")
+		p.block(x.Consequence)
+		if x.Alternative != nil {
+			p.print(" else ")
+			p.block(x.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.print("fn")
+		p.parameters(x.Parameters)
+		p.block(x.Body)
+	case *ast.MacroLiteral:
+		p.print("macro")
+		p.parameters(x.Parameters)
+		p.block(x.Body)
+	case *ast.CallExpression:
+		p.expression(x.Function, call)
+		p.print("(")
+		for i, arg := range x.Arguments {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expression(arg, lowest)
+		}
+		p.print(")")
+	case *ast.IndexExpression:
+		p.expression(x.Left, call)
+		p.print("[")
+		p.expression(x.Index, lowest)
+		p.print("]")
+	case *ast.ArrayLiteral:
+		p.arrayLiteral(x)
+	case *ast.HashLiteral:
+		p.hashLiteral(x)
+	default:
+		p.errorf(x)
+	}
+}
+
+// parameters writes a parenthesized parameter list, followed by a space.
+func (p *printer) parameters(params []*ast.Identifier) {
+	p.print("(")
+	for i, param := range params {
+		if i > 0 {
+			p.print(", ")
+		}
+		if param == nil {
+			p.errorf(nil)
+			return
+		}
+		p.print(param.Value)
+	}
+	p.print(") ")
+}
+
+// block writes a block statement in braces, with its statements indented on
+// separate lines.
+func (p *printer) block(block *ast.BlockStatement) {
+	if block == nil {
+		p.errorf(nil)
+		return
+	}
+	if len(block.Statements) == 0 && !p.commentBefore(block.Rbrace) {
+		p.print("{}")
+		return
+	}
+
+	p.print("{")
+	p.last = block.Pos()
+	p.indent++
+	p.statements(block.Statements, true)
+	p.flush(block.Rbrace)
+	p.indent--
+	p.newline()
+	p.print("}")
+	p.last = block.End()
+}
+
+// arrayLiteral writes an array literal, on one line or with one element per
+// line as in the source.
+func (p *printer) arrayLiteral(array *ast.ArrayLiteral) {
+	var first ast.Node
+	if len(array.Elements) > 0 {
+		first = array.Elements[0]
+	}
+	if !multiline(array, first, array.Rbrack) {
+		p.print("[")
+		for i, elem := range array.Elements {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expression(elem, lowest)
+		}
+		p.print("]")
+		return
+	}
+
+	p.print("[")
+	p.last = array.Pos()
+	p.indent++
+	for i, elem := range array.Elements {
+		if i > 0 {
+			p.print(",")
+		}
+		p.flush(start(elem))
+		p.newline()
+		p.expression(elem, lowest)
+		p.last = end(elem)
+	}
+	p.flush(array.Rbrack)
+	p.indent--
+	p.newline()
+	p.print("]")
+}
+
+// hashLiteral writes a hash literal, on one line or with one pair per line
+// as in the source.
+func (p *printer) hashLiteral(hash *ast.HashLiteral) {
+	var first ast.Node
+	if len(hash.Pairs) > 0 {
+		first = hash.Pairs[0].Key
+	}
+	if !multiline(hash, first, hash.Rbrace) {
+		p.print("{")
+		for i, pair := range hash.Pairs {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.pair(pair)
+		}
+		p.print("}")
+		return
+	}
+
+	p.print("{")
+	p.last = hash.Pos()
+	p.indent++
+	for _, pair := range hash.Pairs {
+		p.flush(start(pair.Key))
+		p.newline()
+		p.pair(pair)
+		p.print(",")
+		p.last = end(pair.Value)
+	}
+	p.flush(hash.Rbrace)
+	p.indent--
+	p.newline()
+	p.print("}")
+}
+
+// pair writes a key-value pair of a hash literal.
+func (p *printer) pair(pair ast.HashPair) {
+	p.expression(pair.Key, lowest)
+	p.print(": ")
+	p.expression(pair.Value, lowest)
+}
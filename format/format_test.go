@@ -0,0 +1,218 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5", "let x = 5;\n"},
+		{"return   x", "return x;\n"},
+		{"a + b * c", "a + b * c;\n"},
+		{"(a + b) * c", "(a + b) * c;\n"},
+		{"((a * b)) + c", "a * b + c;\n"},
+		{"a - (b - c)", "a - (b - c);\n"},
+		{"(a - b) - c", "a - b - c;\n"},
+		{"a < b == (c > d)", "a < b == c > d;\n"},
+		{"(a == b) == c", "a == b == c;\n"},
+		{"a == (b == c)", "a == (b == c);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"-(-a)", "--a;\n"},
+		{"!(a)", "!a;\n"},
+		{"(-a) * b", "-a * b;\n"},
+		{"-(f(x))", "-f(x);\n"},
+		{"(-f)(x)", "(-f)(x);\n"},
+		{"(a + b)[0]", "(a + b)[0];\n"},
+		{"(f(x))[0](y)", "f(x)[0](y);\n"},
+		{`puts("a\tb", "say \"hi\"")`, `puts("a\tb", "say \"hi\"");` + "\n"},
+		{"[1,2 , 3]", "[1, 2, 3];\n"},
+		{`{"a":1,"b" : 2}`, `{"a": 1, "b": 2};` + "\n"},
+		{"{}", "{};\n"},
+		{"[]", "[];\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"let add = fn(a,b){a+b};",
+			"let add = fn(a, b) {\n\ta + b\n};\n"},
+		{"let f = fn(x) { let y = x * 2; y; return y }",
+			"let f = fn(x) {\n\tlet y = x * 2;\n\ty;\n\treturn y;\n};\n"},
+		{"if (x > 1) { x } else { y }",
+			"if (x > 1) {\n\tx\n} else {\n\ty\n}\n"},
+		{"if (x) { if (y) { 1 } }",
+			"if (x) {\n\tif (y) {\n\t\t1\n\t}\n}\n"},
+		{"fn() {\n let a = 1;\n\n a\n}",
+			"fn() {\n\tlet a = 1;\n\n\ta\n};\n"},
+		{"let m = macro(a) { quote(unquote(a)) };",
+			"let m = macro(a) {\n\tquote(unquote(a))\n};\n"},
+		{"map(arr, fn(x) { x * 2 })",
+			"map(arr, fn(x) {\n\tx * 2\n});\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"let a = [\n1, 2,\n3];",
+			"let a = [\n\t1,\n\t2,\n\t3\n];\n"},
+		{"let h = {\n\"one\": 1, \"two\": 2};",
+			"let h = {\n\t\"one\": 1,\n\t\"two\": 2,\n};\n"},
+		{"if (a) { 1 }; let b = 2", "if (a) {\n\t1\n}\nlet b = 2;\n"},
+		{"if (a) { 1 }; -b", "if (a) {\n\t1\n};\n-b;\n"},
+		{"if (a) { 1 }; (b + c) * d", "if (a) {\n\t1\n};\n(b + c) * d;\n"},
+		{"if (a) { 1 }; [1][0]", "if (a) {\n\t1\n};\n[1][0];\n"},
+		{"if (a) { 1 }; !b", "if (a) {\n\t1\n}\n!b;\n"},
+		{"#!/usr/bin/env monkey\nputs( 1 )", "#!/usr/bin/env monkey\nputs(1);\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) is %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"// doc\nlet x=1 // trailing\n", "// doc\nlet x = 1; // trailing\n"},
+		{"let x = 1;\n\n\n// after a gap\n\nlet y = 2;",
+			"let x = 1;\n\n// after a gap\n\nlet y = 2;\n"},
+		{"let f = fn(x) { // opening\n// first\nx /* inline */ + 1 // sum\n// end\n}",
+			"let f = fn(x) { // opening\n\t// first\n\tx /* inline */ + 1 // sum\n" +
+				"\t// end\n};\n"},
+		{"let f = fn() {\n// nothing yet\n}", "let f = fn() {\n\t// nothing yet\n};\n"},
+		{"let a = [\n1, // one\n2 /* two */\n];",
+			"let a = [\n\t1, // one\n\t2 /* two */\n];\n"},
+		{"let h = {\n// first\n\"a\": 1, // a\n};",
+			"let h = {\n\t// first\n\t\"a\": 1, // a\n};\n"},
+		{"f(1, // one\n2)\nlet y = 2;", "f(1, 2);\n// one\nlet y = 2;\n"},
+		{"/* a\n * b\n */\nx", "/* a\n * b\n */\nx;\n"},
+		{"let x = 1;\n/* note */ puts(x)", "let x = 1;\n/* note */ puts(x);\n"},
+		{"/* b */ let b = 2;", "/* b */ let b = 2;\n"},
+		{"/* b */ return 2;", "/* b */ return 2;\n"},
+		{"fn() {\n/* b */ return 2;\n}", "fn() {\n\t/* b */ return 2;\n};\n"},
+		{"x // end\n\n// trailer\n", "x; // end\n\n// trailer\n"},
+		{"fn() {\n\t1;\n\n\t// two\n\t2\n}",
+			"fn() {\n\t1;\n\n\t// two\n\t2\n};\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) is %q, want %q", tt.input, got, tt.expected)
+		}
+		again, err := Source(got)
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", got, err)
+		} else if !bytes.Equal(again, got) {
+			t.Errorf("Source(%q) is %q, want it unchanged", got, again)
+		}
+	}
+}
+
+// TestSourcePreservesTree checks that formatting leaves the syntax tree
+// unchanged and that formatting formatted source changes nothing.
+func TestSourcePreservesTree(t *testing.T) {
+	tests := []string{
+		"1 + 2 + 3 - 4 * 5 / 6 / 7",
+		"a * (b * c) / (d / e)",
+		"!-a == -!b != (a < b) > c",
+		"add(a + b + c * d / f + g, [1, 2][0], -x)",
+		"a * [1, 2, 3, 4][b * c] * d",
+		"let f = fn(x, y) { if (x < y) { return x; } else { y } }; f(1, 2)",
+		"fn(x) { x }(5)",
+		"if (a) { b } else { c } + 1",
+		"if (a) { b }\n-c",
+		`let h = {"a": fn() { 1 }, true: [1, {}], 2: "x"}; h["a"]()`,
+		"let unless = macro(c, t, e) { quote(if (!(unquote(c))) { unquote(t) } else { unquote(e) }) };",
+	}
+
+	for _, input := range tests {
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", input, err)
+			continue
+		}
+		if got, want := parse(t, string(formatted)).String(),
+			parse(t, input).String(); got != want {
+			t.Errorf("Source(%q) is %q, which parses as %q, want %q", input,
+				formatted, got, want)
+		}
+		again, err := Source(formatted)
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", formatted, err)
+			continue
+		}
+		if !bytes.Equal(again, formatted) {
+			t.Errorf("Source(%q) is %q, want it unchanged", formatted, again)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("parser errors in %q: %v", input, err)
+	}
+	return program
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 5;"))
+	if err == nil {
+		t.Fatalf("Source succeeded on a syntax error")
+	}
+	if _, ok := err.(parser.ErrorList); !ok {
+		t.Errorf("error is %T, want parser.ErrorList", err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parse(t, "let x = 1 + 2 * 3;")
+	stmt := program.Statements[0].(*ast.LetStatement)
+
+	var buf bytes.Buffer
+	if err := Node(&buf, stmt.Value); err != nil {
+		t.Fatalf("Node error: %s", err)
+	}
+	if got, want := buf.String(), "1 + 2 * 3"; got != want {
+		t.Errorf("Node is %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	err := Node(&buf, &ast.Program{Statements: []ast.Statement{
+		&ast.BadStatement{},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "cannot format *ast.BadStatement") {
+		t.Errorf("Node error is %v, want cannot format *ast.BadStatement", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Node wrote %q on error, want nothing", buf.String())
+	}
+
+	buf.Reset()
+	err = Node(&buf, &ast.InfixExpression{Operator: "+",
+		Left: &ast.Identifier{Value: "a"}})
+	if err == nil || !strings.Contains(err.Error(), "missing node") {
+		t.Errorf("Node error is %v, want missing node", err)
+	}
+}
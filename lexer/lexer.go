@@ -1,49 +1,226 @@
 // Package lexer scans Monkey source code for tokens.
 package lexer // import "github.com/pto/monkey/lexer"
 
-import "github.com/pto/monkey/token"
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
-// Lexer is a scanner for Monkey source code.
+	"github.com/pto/monkey/token"
+)
+
+// ErrorHandler is called with the position and message of each error found
+// by a Lexer.
+type ErrorHandler func(pos token.Position, msg string)
+
+// Mode is a set of flags controlling optional behavior of a Lexer.
+type Mode uint
+
+// Modes of a Lexer.
+const (
+	ScanComments Mode = 1 << iota // return comments as COMMENT tokens
+)
+
+// bufferSize is the number of bytes a Lexer reads from an io.Reader at a
+// time.
+const bufferSize = 4096
+
+// Lexer is a scanner for Monkey source code, which must be encoded in UTF-8.
 type Lexer struct {
-	input        string
-	position     int  // position of current character
-	readPosition int  // read position (after current character)
-	ch           byte // current character
+	filename     string
+	mode         Mode
+	reader       io.Reader // source of further input, or nil
+	readErr      error     // error that ended the input from reader
+	buf          []byte    // input, starting at offset base
+	base         int       // offset of buf[0] in the input
+	mark         int       // offset of the first byte that must stay in buf
+	started      bool      // the first character has been read
+	position     int       // position of current character
+	readPosition int       // read position (after current character)
+	ch           rune      // current character
+	width        int       // width in bytes of current character
+	line         int       // line of current character
+	column       int       // column of current character, in runes
+	errorHandler ErrorHandler
+	errorCount   int
 }
 
 // New creates a new Lexer over the input string.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a new Lexer over the input string, using filename in the
+// positions of the tokens it returns. A "#!" line at the start of the input is
+// ignored.
+func NewFile(filename, input string) *Lexer {
+	return &Lexer{filename: filename, buf: []byte(input), line: 1}
+}
+
+// NewReader creates a new Lexer over the input read from r.
+func NewReader(r io.Reader) *Lexer {
+	return NewFileReader("", r)
+}
+
+// NewFileReader creates a new Lexer over the input read from r, using
+// filename in the positions of the tokens it returns. The input is read as it
+// is needed, and only the current token is kept in memory, so the tokens
+// returned are the same as from NewFile without the whole input being held at
+// once. A read error is reported as an error and ends the input.
+func NewFileReader(filename string, r io.Reader) *Lexer {
+	return &Lexer{filename: filename, reader: r, line: 1}
+}
+
+// start reads the first character, unless it has been read. It is called
+// by NextToken rather than NewFile so that errors in the first character go
+// to the error handler.
+func (l *Lexer) start() {
+	if l.started {
+		return
+	}
+	l.started = true
 	l.readChar()
-	return l
+	l.skipShebang()
 }
 
-// readChar reads the next character in the input string and advances the read
-// position.
+// SetErrorHandler arranges for h to be called for each error found by the
+// Lexer. Tokens containing errors are still returned by NextToken, as
+// ILLEGAL if they cannot be scanned at all.
+func (l *Lexer) SetErrorHandler(h ErrorHandler) {
+	l.errorHandler = h
+}
+
+// SetMode sets the mode of the Lexer. By default, comments are skipped like
+// white space.
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+// ErrorCount returns the number of errors found so far.
+func (l *Lexer) ErrorCount() int {
+	return l.errorCount
+}
+
+// error reports an error at pos.
+func (l *Lexer) error(pos token.Position, msg string) {
+	l.errorCount++
+	if l.errorHandler != nil {
+		l.errorHandler(pos, msg)
+	}
+}
+
+// readChar reads the next character in the input and advances the read
+// position. At the end of the input, the position stays at the length of the
+// input. A byte that does not start a valid UTF-8 encoding is reported as an
+// error and read as utf8.RuneError.
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
 	}
+	l.fill()
+	if l.readPosition >= l.base+len(l.buf) {
+		if l.width > 0 || l.column == 0 {
+			l.column++ // step past the last character once
+		}
+		l.ch, l.width = 0, 0
+		l.position = l.readPosition
+		if l.readErr != nil {
+			l.error(l.pos(), fmt.Sprintf("read error: %s", l.readErr))
+			l.readErr = nil
+		}
+		return
+	}
+
+	l.ch, l.width = utf8.DecodeRune(l.buf[l.readPosition-l.base:])
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += l.width
+	l.column++
+	if l.invalid() {
+		l.error(l.pos(), "invalid UTF-8 encoding")
+	}
+}
+
+// invalid reports whether the current character is an invalid UTF-8
+// encoding.
+func (l *Lexer) invalid() bool {
+	return l.ch == utf8.RuneError && l.width == 1
 }
 
-// peekChar reads the next character in the input string but does not advance
-// the read position.
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// pos returns the Position of the current character.
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+// peekChar reads the next character in the input but does not advance the
+// read position.
+func (l *Lexer) peekChar() rune {
+	l.fill()
+	if l.readPosition >= l.base+len(l.buf) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRune(l.buf[l.readPosition-l.base:])
+	return r
+}
+
+// fill reads from the reader, if any, until a whole character is buffered at
+// the read position or the input ends. Bytes before the mark are discarded
+// to make room.
+func (l *Lexer) fill() {
+	for l.reader != nil && l.base+len(l.buf)-l.readPosition < utf8.UTFMax {
+		if l.mark > l.base {
+			n := copy(l.buf, l.buf[l.mark-l.base:])
+			l.buf = l.buf[:n]
+			l.base = l.mark
+		}
+		if len(l.buf) == cap(l.buf) {
+			l.buf = append(l.buf, make([]byte, bufferSize)...)[:len(l.buf)]
+		}
+
+		n, err := l.reader.Read(l.buf[len(l.buf):cap(l.buf)])
+		l.buf = l.buf[:len(l.buf)+n]
+		if err != nil {
+			if err != io.EOF {
+				l.readErr = err // reported at the end of the input
+			}
+			l.reader = nil
+		}
+	}
 }
 
-// NextToken returns the next token scanned by the Lexer.
+// text returns the input from offset start to offset end, which must both be
+// at or after the mark.
+func (l *Lexer) text(start, end int) string {
+	return string(l.buf[start-l.base : end-l.base])
+}
+
+// NextToken returns the next token scanned by the Lexer. Comments are
+// skipped unless the Lexer is in ScanComments mode.
 func (l *Lexer) NextToken() token.Token {
+	l.start()
+	for {
+		tok := l.scan()
+		if tok.Type != token.COMMENT || l.mode&ScanComments != 0 {
+			return tok
+		}
+	}
+}
+
+// scan returns the next token, including comments.
+func (l *Lexer) scan() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := l.pos()
+	l.mark = l.position
 
 	switch l.ch {
 	case '=':
@@ -57,6 +234,8 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -77,6 +256,11 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
+		if next := l.peekChar(); next == '/' || next == '*' {
+			tok.Type, tok.Literal = token.COMMENT, l.readComment()
+			tok.Pos, tok.End = pos, l.pos()
+			return tok
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
@@ -88,6 +272,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		tok.Type, tok.Literal = l.readString()
+		tok.Pos, tok.End = pos, l.pos()
+		return tok
 	case 0:
 		tok.Type = token.EOF
 		tok.Literal = ""
@@ -95,16 +287,23 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
+			if l.invalid() {
+				tok.Literal = l.text(l.position, l.readPosition)
+			} else {
+				l.error(pos, fmt.Sprintf("illegal character %q", l.ch))
+			}
 		}
 	}
 	l.readChar()
+	tok.Pos, tok.End = pos, l.pos()
 	return tok
 }
 
@@ -112,20 +311,182 @@ func (l *Lexer) NextToken() token.Token {
 // read position past it.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) || isUnicodeDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.text(position, l.position)
 }
 
 // readNumber returns the lexeme for an integer and advances the read
-// position past it.
-func (l *Lexer) readNumber() string {
+// position past it. An integer is decimal, or hexadecimal, octal or binary
+// with a 0x, 0o or 0b prefix; a leading 0 alone also makes it octal. Digits
+// may be separated by underscores. A malformed integer is returned as
+// ILLEGAL.
+func (l *Lexer) readNumber() (token.Type, string) {
+	start := l.pos()
+	base, name, prefixed := 10, "decimal", false
+	if l.ch == '0' {
+		base, name = 8, "octal"
+		switch l.peekChar() {
+		case 'x', 'X':
+			base, name, prefixed = 16, "hexadecimal", true
+		case 'o', 'O':
+			prefixed = true
+		case 'b', 'B':
+			base, name, prefixed = 2, "binary", true
+		}
+		if prefixed {
+			l.readChar()
+			l.readChar()
+		}
+	}
+
 	position := l.position
-	for isDigit(l.ch) {
+	var invalid token.Position
+	var invalidDigit rune
+	for isDigit(l.ch) || base == 16 && isHexDigit(l.ch) || l.ch == '_' {
+		if isDigit(l.ch) && int(l.ch-'0') >= base && invalidDigit == 0 {
+			invalid, invalidDigit = l.pos(), l.ch
+		}
+		l.readChar()
+	}
+	digits := l.text(position, l.position)
+	literal := l.text(start.Offset, l.position)
+
+	if prefixed && strings.Trim(digits, "_") == "" {
+		l.error(start, name+" literal has no digits")
+	} else if invalidDigit != 0 {
+		l.error(invalid, fmt.Sprintf("invalid digit %q in %s literal",
+			invalidDigit, name))
+	} else if i := invalidSeparator(digits); i >= 0 {
+		pos := start
+		pos.Offset += len(literal) - len(digits) + i
+		pos.Column += len(literal) - len(digits) + i
+		l.error(pos, "'_' must separate successive digits")
+	} else {
+		return token.INT, literal
+	}
+	return token.ILLEGAL, literal
+}
+
+// invalidSeparator returns the index of the first underscore in digits that
+// is not followed by a digit, or -1 if there is none.
+func invalidSeparator(digits string) int {
+	for i := 0; i < len(digits); i++ {
+		if digits[i] == '_' && (i+1 == len(digits) || digits[i+1] == '_') {
+			return i
+		}
+	}
+	return -1
+}
+
+// readComment returns the text of a "//" or "/* */" comment and advances the
+// read position past it. A line comment does not include the end of the
+// line.
+func (l *Lexer) readComment() string {
+	start := l.pos()
+	l.readChar() // slash
+
+	if l.ch == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return strings.TrimSuffix(l.text(start.Offset, l.position), "\r")
+	}
+
+	l.readChar() // asterisk
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			l.error(start, "comment not terminated")
+			return l.text(start.Offset, l.position)
+		}
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	l.readChar()
+	l.readChar()
+	return l.text(start.Offset, l.position)
+}
+
+// readString returns the value of a string literal, with escape sequences
+// replaced, and advances the read position past its closing quote. An
+// unterminated string is returned as ILLEGAL with its raw text.
+func (l *Lexer) readString() (token.Type, string) {
+	start := l.pos()
+	var value strings.Builder
+
+	l.readChar() // opening quote
+	for l.ch != '"' {
+		switch l.ch {
+		case 0, '\n':
+			l.error(start, "string literal not terminated")
+			return token.ILLEGAL, l.text(start.Offset, l.position)
+		case '\\':
+			l.readEscape(&value)
+		default:
+			value.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+	l.readChar() // closing quote
+
+	return token.STRING, value.String()
+}
+
+// readEscape writes the character for the escape sequence at the current
+// position to value and advances the read position past it.
+func (l *Lexer) readEscape(value *strings.Builder) {
+	pos := l.pos()
+	l.readChar() // backslash
+
+	switch l.ch {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case '"':
+		value.WriteByte('"')
+	case '\\':
+		value.WriteByte('\\')
+	case 'u':
+		l.readUnicodeEscape(pos, value)
+		return
+	case 0, '\n':
+		return // reported as unterminated by readString
+	default:
+		l.error(pos, fmt.Sprintf("unknown escape sequence \\%c", l.ch))
+	}
+	l.readChar()
+}
+
+// readUnicodeEscape writes the character for a \u{...} escape sequence,
+// starting at the u, to value and advances the read position past it.
+func (l *Lexer) readUnicodeEscape(pos token.Position, value *strings.Builder) {
+	l.readChar() // u
+	if l.ch != '{' {
+		l.error(pos, "\\u must be followed by {hex digits}")
+		return
+	}
+	l.readChar()
+
+	start := l.position
+	for isHexDigit(l.ch) {
+		l.readChar()
+	}
+	digits := l.text(start, l.position)
+	if l.ch != '}' || len(digits) == 0 || len(digits) > 6 {
+		l.error(pos, "\\u{...} must contain 1 to 6 hex digits")
+		return
+	}
+	l.readChar()
+
+	n, _ := strconv.ParseUint(digits, 16, 32)
+	r := rune(n)
+	if !utf8.ValidRune(r) {
+		l.error(pos, fmt.Sprintf("escape sequence \\u{%s} is not a valid "+
+			"Unicode code point", digits))
+		return
+	}
+	value.WriteRune(r)
 }
 
 // skipWhitespace advances the read position to the next non-blank.
@@ -135,17 +496,41 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipShebang advances the read position past a "#!" interpreter line at the
+// very start of the input, so that scripts can be executed directly.
+func (l *Lexer) skipShebang() {
+	if l.position != 0 || l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
 // newToken is a wrapper for a Token struct literal.
-func newToken(tokenType token.Type, ch byte) token.Token {
+func newToken(tokenType token.Type, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-// isLetter returns true for 'a' through 'z', 'A' through 'Z' and underscore.
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter returns true for a Unicode letter or underscore, which can start
+// an identifier.
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+// isUnicodeDigit returns true for a non-ASCII Unicode decimal digit, which
+// can appear in an identifier after its first character.
+func isUnicodeDigit(ch rune) bool {
+	return ch >= utf8.RuneSelf && unicode.IsDigit(ch)
+}
+
+// isHexDigit returns true for a hexadecimal digit.
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
 }
 
-// isDigit returns true for a decimal digit.
-func isDigit(ch byte) bool {
+// isDigit returns true for an ASCII decimal digit, which can start a number.
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -1,7 +1,13 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/pto/monkey/token"
 )
@@ -15,7 +21,7 @@ func TestNextToken(t *testing.T) {
 			  };
 
 			  let result = add(five, ten);
-			  !-/*5;
+			  !-/ *5;
 			  5 < 10 > 5;
 
 			  if (5 < 10) {
@@ -26,6 +32,11 @@ func TestNextToken(t *testing.T) {
 			  
 			  10 == 10;
 			  10 != 9;
+			  "foobar"
+			  "foo bar"
+			  [1, 2];
+			  {"foo": "bar"}
+			  macro(x, y) { x + y; };
 			  `
 
 	tests := []struct {
@@ -104,6 +115,32 @@ func TestNextToken(t *testing.T) {
 		{token.NOTEQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -122,3 +159,402 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x != 9\n"
+	pos := func(offset, line, column int) token.Position {
+		return token.Position{Filename: "f.mk", Offset: offset, Line: line,
+			Column: column}
+	}
+
+	tests := []struct {
+		expectedType token.Type
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, pos(0, 1, 1), pos(3, 1, 4)},
+		{token.IDENT, pos(4, 1, 5), pos(5, 1, 6)},
+		{token.ASSIGN, pos(6, 1, 7), pos(7, 1, 8)},
+		{token.INT, pos(8, 1, 9), pos(10, 1, 11)},
+		{token.SEMICOLON, pos(10, 1, 11), pos(11, 1, 12)},
+		{token.IDENT, pos(14, 2, 3), pos(15, 2, 4)},
+		{token.NOTEQ, pos(16, 2, 5), pos(18, 2, 7)},
+		{token.INT, pos(19, 2, 8), pos(20, 2, 9)},
+		{token.EOF, pos(21, 3, 1), pos(21, 3, 1)},
+		{token.EOF, pos(21, 3, 1), pos(21, 3, 1)},
+	}
+
+	lex := NewFile("f.mk", input)
+
+	for i, test := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Fatalf("tests[%d]: wrong token type, expecting %q, got %q",
+				i, test.expectedType, tok.Type)
+		}
+		if tok.Pos != test.expectedPos {
+			t.Errorf("tests[%d]: wrong position, expecting %+v, got %+v",
+				i, test.expectedPos, tok.Pos)
+		}
+		if tok.End != test.expectedEnd {
+			t.Errorf("tests[%d]: wrong end, expecting %+v, got %+v",
+				i, test.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// one\nx / y // two\r\n/* three\n */ z /**/"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedPos     string
+		expectedEnd     string
+	}{
+		{token.COMMENT, "// one", "1:1", "1:7"},
+		{token.IDENT, "x", "2:1", "2:2"},
+		{token.SLASH, "/", "2:3", "2:4"},
+		{token.IDENT, "y", "2:5", "2:6"},
+		{token.COMMENT, "// two", "2:7", "2:14"},
+		{token.COMMENT, "/* three\n */", "3:1", "4:4"},
+		{token.IDENT, "z", "4:5", "4:6"},
+		{token.COMMENT, "/**/", "4:7", "4:11"},
+		{token.EOF, "", "4:11", "4:11"},
+	}
+
+	l := New(input)
+	l.SetMode(ScanComments)
+	var idents []string
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Fatalf("tests[%d]: wrong token type, expecting %q, got %q",
+				i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("tests[%d]: wrong literal, expecting %q, got %q",
+				i, test.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != test.expectedPos ||
+			tok.End.String() != test.expectedEnd {
+			t.Errorf("tests[%d]: wrong extent, expecting %s-%s, got %s-%s",
+				i, test.expectedPos, test.expectedEnd, tok.Pos, tok.End)
+		}
+		if tok.Type == token.IDENT || tok.Type == token.SLASH {
+			idents = append(idents, tok.Literal)
+		}
+	}
+
+	// Without ScanComments, the comments are skipped.
+	l = New(input)
+	for i, want := range append(idents, "") {
+		tok := l.NextToken()
+		if tok.Literal != want {
+			t.Errorf("without comments, token %d is %q, want %q", i,
+				tok.Literal, want)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let café = \"😀 ok\";\n  π2 + x١ / ñ"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedPos     string
+		expectedEnd     string
+	}{
+		{token.LET, "let", "1:1", "1:4"},
+		{token.IDENT, "café", "1:5", "1:9"},
+		{token.ASSIGN, "=", "1:10", "1:11"},
+		{token.STRING, "😀 ok", "1:12", "1:18"},
+		{token.SEMICOLON, ";", "1:18", "1:19"},
+		{token.IDENT, "π2", "2:3", "2:5"},
+		{token.PLUS, "+", "2:6", "2:7"},
+		{token.IDENT, "x١", "2:8", "2:10"},
+		{token.SLASH, "/", "2:11", "2:12"},
+		{token.IDENT, "ñ", "2:13", "2:14"},
+		{token.EOF, "", "2:14", "2:14"},
+	}
+
+	l := New(input)
+	l.SetErrorHandler(func(pos token.Position, msg string) {
+		t.Errorf("unexpected error at %s: %s", pos, msg)
+	})
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Fatalf("tests[%d]: wrong token type, expecting %q, got %q",
+				i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("tests[%d]: wrong literal, expecting %q, got %q",
+				i, test.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != test.expectedPos ||
+			tok.End.String() != test.expectedEnd {
+			t.Errorf("tests[%d]: wrong extent, expecting %s-%s, got %s-%s",
+				i, test.expectedPos, test.expectedEnd, tok.Pos, tok.End)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "0x1F 0XaB 0o17 0O7 0b1010 0B1 1_000_000 017 0 0x_1 12abc"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.INT, "0x1F"},
+		{token.INT, "0XaB"},
+		{token.INT, "0o17"},
+		{token.INT, "0O7"},
+		{token.INT, "0b1010"},
+		{token.INT, "0B1"},
+		{token.INT, "1_000_000"},
+		{token.INT, "017"},
+		{token.INT, "0"},
+		{token.INT, "0x_1"},
+		{token.INT, "12"},
+		{token.IDENT, "abc"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	l.SetErrorHandler(func(pos token.Position, msg string) {
+		t.Errorf("unexpected error at %s: %s", pos, msg)
+	})
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Fatalf("tests[%d]: wrong token type, expecting %q, got %q",
+				i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("tests[%d]: wrong literal, expecting %q, got %q",
+				i, test.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType token.Type
+		expectedLine int
+	}{
+		{"#!/usr/bin/env monkey\nlet", token.LET, 2},
+		{"#!/usr/bin/env monkey", token.EOF, 1},
+		{" #!/usr/bin/env monkey\nlet", token.ILLEGAL, 1},
+	}
+
+	for i, test := range tests {
+		tok := New(test.input).NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Errorf("tests[%d]: wrong token type, expecting %q, got %q",
+				i, test.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != test.expectedLine {
+			t.Errorf("tests[%d]: wrong line, expecting %d, got %d",
+				i, test.expectedLine, tok.Pos.Line)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"a\tb"`, "a\tb"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{41}\u{e9}\u{1F600}"`, "A\u00e9\U0001F600"},
+		{`""`, ""},
+	}
+
+	for i, test := range tests {
+		var errors []string
+		l := New(test.input)
+		l.SetErrorHandler(func(pos token.Position, msg string) {
+			errors = append(errors, msg)
+		})
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Errorf("tests[%d]: wrong token type, expecting %q, got %q",
+				i, token.STRING, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("tests[%d]: wrong literal, expecting %q, got %q",
+				i, test.expectedLiteral, tok.Literal)
+		}
+		if tok.End.Offset != len(test.input) {
+			t.Errorf("tests[%d]: wrong end offset, expecting %d, got %d",
+				i, len(test.input), tok.End.Offset)
+		}
+		if len(errors) != 0 {
+			t.Errorf("tests[%d]: unexpected errors %q", i, errors)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedType  token.Type
+		expectedError string
+		expectedPos   string
+	}{
+		{`"abc`, token.ILLEGAL, "string literal not terminated", "1:1"},
+		{"x = \"abc\ndef\"", token.ILLEGAL, "string literal not terminated",
+			"1:5"},
+		{`"a\qb"`, token.STRING, `unknown escape sequence \q`, "1:3"},
+		{`"\u41"`, token.STRING, `\u must be followed by {hex digits}`, "1:2"},
+		{`"\u{}"`, token.STRING, `\u{...} must contain 1 to 6 hex digits`,
+			"1:2"},
+		{`"\u{D800}"`, token.STRING,
+			`escape sequence \u{D800} is not a valid Unicode code point`, "1:2"},
+		{"@", token.ILLEGAL, `illegal character '@'`, "1:1"},
+		{"x /* abc", token.EOF, "comment not terminated", "1:3"},
+		{"é @", token.ILLEGAL, `illegal character '@'`, "1:3"},
+		{"0x;", token.ILLEGAL, "hexadecimal literal has no digits", "1:1"},
+		{"0b_", token.ILLEGAL, "binary literal has no digits", "1:1"},
+		{"0b102", token.ILLEGAL, "invalid digit '2' in binary literal", "1:5"},
+		{"x = 0o78", token.ILLEGAL, "invalid digit '8' in octal literal",
+			"1:8"},
+		{"019", token.ILLEGAL, "invalid digit '9' in octal literal", "1:3"},
+		{"1__000", token.ILLEGAL, "'_' must separate successive digits",
+			"1:2"},
+		{"0x1F_ ", token.ILLEGAL, "'_' must separate successive digits",
+			"1:5"},
+		{"\xffx", token.ILLEGAL, "invalid UTF-8 encoding", "1:1"},
+		{"x = \xc3;", token.ILLEGAL, "invalid UTF-8 encoding", "1:5"},
+		{"\"é\xff\"", token.STRING, "invalid UTF-8 encoding", "1:3"},
+		{"// é\xff\nx", token.IDENT, "invalid UTF-8 encoding", "1:5"},
+	}
+
+	for i, test := range tests {
+		var errors []string
+		l := New(test.input)
+		l.SetErrorHandler(func(pos token.Position, msg string) {
+			errors = append(errors, pos.String()+": "+msg)
+		})
+
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Type == test.expectedType {
+				break
+			}
+		}
+		if tok.Type != test.expectedType {
+			t.Errorf("tests[%d]: no token of type %q", i, test.expectedType)
+		}
+
+		want := test.expectedPos + ": " + test.expectedError
+		if len(errors) != 1 || errors[0] != want {
+			t.Errorf("tests[%d]: errors are %q, want [%q]", i, errors, want)
+		}
+		if l.ErrorCount() != 1 {
+			t.Errorf("tests[%d]: ErrorCount() is %d, want 1", i, l.ErrorCount())
+		}
+	}
+}
+
+// lexAll returns a description of each token and error from l, up to and
+// including EOF.
+func lexAll(l *Lexer) []string {
+	var out []string
+	l.SetMode(ScanComments)
+	l.SetErrorHandler(func(pos token.Position, msg string) {
+		out = append(out, fmt.Sprintf("error %s: %s", pos, msg))
+	})
+	for {
+		tok := l.NextToken()
+		out = append(out, fmt.Sprintf("%s %q %s-%s (%d-%d)", tok.Type,
+			tok.Literal, tok.Pos, tok.End, tok.Pos.Offset, tok.End.Offset))
+		if tok.Type == token.EOF {
+			return out
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	long := strings.Repeat("abcdé", bufferSize/3)
+	inputs := []string{
+		"",
+		"#!/usr/bin/env monkey\nlet x = 5;",
+		"let add = fn(a, b) { a + b };\nadd(1, 2) != 3\n",
+		"/* block\n comment */ x // line\r\n[1, 2][0]",
+		"let café = \"😀 \\u{1F600}\\n\";\n  π2 + x١ / ñ",
+		"x = \xff\xc3; \"a\xe2\x82\" @ \"unterminated",
+		"let s = \"" + long + "\"; // " + long + "\n" + long,
+		strings.Repeat("{\"key\": [1, 2, 3]}\n", bufferSize/5),
+		strings.Repeat(" ", bufferSize-1) + "😀" + "\xe2\x82",
+	}
+
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"Reader", func(r io.Reader) io.Reader { return r }},
+		{"OneByteReader", iotest.OneByteReader},
+		{"HalfReader", iotest.HalfReader},
+		{"DataErrReader", iotest.DataErrReader},
+	}
+
+	for i, input := range inputs {
+		want := lexAll(NewFile("f.mk", input))
+		for _, r := range readers {
+			l := NewFileReader("f.mk", r.wrap(strings.NewReader(input)))
+			got := lexAll(l)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("inputs[%d] with %s: tokens are\n%q\nwant\n%q", i,
+					r.name, got, want)
+			}
+		}
+	}
+}
+
+func TestNewReaderBuffer(t *testing.T) {
+	line := "let value = [1, 2, 3]; // a comment on each line\n"
+	lines := 100 * bufferSize / len(line)
+
+	l := NewReader(strings.NewReader(strings.Repeat(line, lines)))
+	n := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		n++
+	}
+	if n != 11*lines {
+		t.Errorf("number of tokens is %d, want %d", n, 11*lines)
+	}
+	if cap(l.buf) > bufferSize {
+		t.Errorf("buffer capacity is %d, want at most %d", cap(l.buf),
+			bufferSize)
+	}
+}
+
+func TestNewReaderError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("x + "),
+		iotest.ErrReader(errors.New("disk on fire")))
+
+	got := lexAll(NewReader(r))
+	want := []string{
+		`IDENT "x" 1:1-1:2 (0-1)`,
+		`+ "+" 1:3-1:4 (2-3)`,
+		"error 1:5: read error: disk on fire",
+		`EOF "" 1:5-1:5 (4-4)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens are %q, want %q", got, want)
+	}
+}
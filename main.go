@@ -1,23 +1,94 @@
-// Monkey starts a REPL for the Monkey programming language.
+// Monkey runs programs written in the Monkey programming language.
+//
+// Usage:
+//
+//	monkey <command> [arguments]
+//
+// The commands are:
+//
+//	run     run a Monkey script or compiled .mkc file
+//	repl    start an interactive session
+//	build   compile a Monkey script to a .mkc file
+//	disasm  list the bytecode compiled from a Monkey script
+//	parse   print the syntax tree of a Monkey script
+//	fmt     format Monkey source files
+//	doc     show the documentation of a Monkey script
+//
+// With no command, monkey starts a REPL. A file name in place of a command
+// runs that file, so scripts starting with "#!/usr/bin/env monkey" can be
+// executed directly.
 package main
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/user"
+)
 
-	"github.com/pto/monkey/repl"
+// Exit codes.
+const (
+	exitOK    = 0 // success
+	exitError = 1 // parse or runtime error
+	exitUsage = 2 // bad command line
 )
 
+// command is a monkey subcommand.
+type command struct {
+	name  string
+	short string // one-line description for the usage message
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "run a Monkey script or compiled .mkc file", runCmd},
+		{"repl", "start an interactive session", replCmd},
+		{"build", "compile a Monkey script to a .mkc file", buildCmd},
+		{"disasm", "list the bytecode compiled from a Monkey script", disasmCmd},
+		{"parse", "print the syntax tree of a Monkey script", parseCmd},
+		{"fmt", "format Monkey source files", fmtCmd},
+		{"doc", "show the documentation of a Monkey script", docCmd},
+	}
+}
+
 func main() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
+	os.Exit(monkey(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// monkey dispatches args to a command and returns the exit code.
+func monkey(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return replCmd(nil, stdin, stdout, stderr)
 	}
-	name := user.Name
-	if name == "" {
-		name = user.Username
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
+	}
+
+	if fi, err := os.Stat(args[0]); err == nil && !fi.IsDir() {
+		return runCmd(args, stdin, stdout, stderr)
+	}
+
+	fmt.Fprintf(stderr, "monkey: unknown command %q\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+// usage writes the top-level usage message to w.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: monkey <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s%s\n", cmd.name, cmd.short)
 	}
-	fmt.Printf("Hello, %s! This is the Monkey programming language.\n", name)
-	repl.Start(os.Stdin, os.Stdout)
+	fmt.Fprintf(w, "\nA file name in place of a command runs that file.\n")
 }
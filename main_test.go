@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pto/monkey/ast"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		src          string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"ok.mk", "#!/usr/bin/env monkey\nlet x = 5;\nx * 2;\n", exitOK, ""},
+		{"parse.mk", "let x = ;\n", exitError,
+			"parse.mk:1:9: no prefix parse function found for ;"},
+		{"runtime.mk", "let x = 5;\nx + y;\n", exitError,
+			"runtime.mk: runtime error: identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(filename, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, args := range [][]string{{"run", filename}, {filename}} {
+			var stdout, stderr bytes.Buffer
+			code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("monkey %q: exit code is %d, want %d (stderr %q)",
+					args, code, tt.expectedCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.expectedErr) {
+				t.Errorf("monkey %q: stderr is %q, want it to contain %q",
+					args, stderr.String(), tt.expectedErr)
+			}
+		}
+	}
+}
+
+func TestRunEngines(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name           string
+		src            string
+		expectedCode   int
+		expectedStdout string
+		expectedErr    string
+	}{
+		{"closures.mk", `let newAdder = fn(x) { fn(y) { x + y } };
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+puts(newAdder(2)(3), fib(10), {"a": [1, "two"]}, first([]));
+`, exitOK, "5\n55\n{a: [1, two]}\nnull\n", ""},
+		{"forward.mk", `let a = fn() { b };
+let b = 2;
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+puts(a(), isEven(10), isOdd(10));
+`, exitOK, "2\ntrue\nfalse\n", ""},
+		{"macro.mk", `let unless = macro(cond, then, otherwise) {
+	quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+};
+unless(1 > 2, puts("smaller"), puts("bigger"));
+`, exitOK, "smaller\n", ""},
+		{"badmacro.mk", "let m = macro() { 1 };\nm();\n", exitError, "",
+			"badmacro.mk: macro expansion error: macro m returned INTEGER, " +
+				"want QUOTE"},
+		{"error.mk", "puts(1);\nlen(1);\nputs(2);\n", exitError, "1\n",
+			"error.mk: runtime error: argument to `len` not supported, " +
+				"got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(filename, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, engine := range []string{"eval", "vm"} {
+			var stdout, stderr bytes.Buffer
+			args := []string{"run", "-engine", engine, filename}
+			code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("monkey %q: exit code is %d, want %d (stderr %q)",
+					args, code, tt.expectedCode, stderr.String())
+			}
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("monkey %q: output is %q, want %q", args,
+					stdout.String(), tt.expectedStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.expectedErr) {
+				t.Errorf("monkey %q: stderr is %q, want it to contain %q",
+					args, stderr.String(), tt.expectedErr)
+			}
+		}
+	}
+}
+
+func TestBuildAndRunCompiled(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "prog.mk")
+	src := "let f = fn(x) { x * 2 };\nputs(f(21));\n"
+	if err := os.WriteFile(source, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compiled := filepath.Join(dir, "out.mkc")
+	tests := []struct {
+		args         []string
+		expectedCode int
+		expectedOut  string
+		expectedErr  string
+	}{
+		{[]string{"build", "-o", compiled, source}, exitOK, "", ""},
+		{[]string{"build", source}, exitOK, "", ""},
+		{[]string{"run", compiled}, exitOK, "42\n", ""},
+		{[]string{filepath.Join(dir, "prog.mkc")}, exitOK, "42\n", ""},
+		{[]string{"run", "-engine", "vm", compiled}, exitOK, "42\n", ""},
+		{[]string{"run", "-engine", "eval", compiled}, exitUsage, "",
+			"can only run on the vm engine"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := monkey(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("monkey %q: exit code is %d, want %d (stderr %q)",
+				tt.args, code, tt.expectedCode, stderr.String())
+		}
+		if stdout.String() != tt.expectedOut {
+			t.Errorf("monkey %q: output is %q, want %q", tt.args,
+				stdout.String(), tt.expectedOut)
+		}
+		if !strings.Contains(stderr.String(), tt.expectedErr) {
+			t.Errorf("monkey %q: stderr is %q, want it to contain %q",
+				tt.args, stderr.String(), tt.expectedErr)
+		}
+	}
+
+	data, err := os.ReadFile(compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(compiled, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := monkey([]string{"run", compiled}, strings.NewReader(""), &stdout,
+		&stderr)
+	want := "out.mkc: compiled file is corrupt: checksum mismatch"
+	if code != exitError || !strings.Contains(stderr.String(), want) {
+		t.Errorf("corrupt file: exit code is %d, stderr %q, want %d and %q",
+			code, stderr.String(), exitError, want)
+	}
+}
+
+func TestDisasm(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "disasm.mk")
+	src := "let x = 1;\nputs(x + 2);\n"
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"disasm", filename}
+	code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("monkey %q: exit code is %d, want %d (stderr %q)", args, code,
+			exitOK, stderr.String())
+	}
+	for _, want := range []string{
+		"; 1: let x = 1;\n0000 OpConstant 0",
+		"; 2: puts(x + 2);\n0006 OpGetBuiltin 1",
+		"OpAdd",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("monkey %q: stdout is %q, want it to contain %q", args,
+				stdout.String(), want)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "parse.mk")
+	src := "let x = 1 + 2;\n"
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"parse", "--json", filename}
+	code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("monkey %q: exit code is %d, want %d (stderr %q)", args, code,
+			exitOK, stderr.String())
+	}
+	node, err := ast.UnmarshalJSON(stdout.Bytes())
+	if err != nil {
+		t.Fatalf("monkey %q: output does not decode: %s", args, err)
+	}
+	if got, want := node.String(), "let x = (1 + 2);"; got != want {
+		t.Errorf("monkey %q: decoded program is %q, want %q", args, got, want)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.mk")
+	tidy := filepath.Join(dir, "tidy.mk")
+	bad := filepath.Join(dir, "bad.mk")
+	for name, src := range map[string]string{
+		messy: "let x=1+ 2;\nputs( x )\n",
+		tidy:  "let y = 2;\n",
+		bad:   "let = 1;\n",
+	} {
+		if err := os.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	formatted := "let x = 1 + 2;\nputs(x);\n"
+
+	tests := []struct {
+		args         []string
+		stdin        string
+		expectedCode int
+		expectedOut  string
+		expectedErr  string
+	}{
+		{[]string{"fmt", messy}, "", exitOK, formatted, ""},
+		{[]string{"fmt"}, "puts( 1 )", exitOK, "puts(1);\n", ""},
+		{[]string{"fmt", "-d", tidy}, "", exitOK, "", ""},
+		{[]string{"fmt", "-d", messy}, "", exitOK,
+			"--- " + messy + ".orig\n+++ " + messy + "\n@@ -1,2 +1,2 @@\n" +
+				"-let x=1+ 2;\n-puts( x )\n+let x = 1 + 2;\n+puts(x);\n", ""},
+		{[]string{"fmt", bad, tidy}, "", exitError, "let y = 2;\n",
+			bad + ":1:5: "},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := monkey(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("monkey %q: exit code is %d, want %d (stderr %q)",
+				tt.args, code, tt.expectedCode, stderr.String())
+		}
+		if stdout.String() != tt.expectedOut {
+			t.Errorf("monkey %q: stdout is %q, want %q", tt.args,
+				stdout.String(), tt.expectedOut)
+		}
+		if !strings.Contains(stderr.String(), tt.expectedErr) {
+			t.Errorf("monkey %q: stderr is %q, want it to contain %q",
+				tt.args, stderr.String(), tt.expectedErr)
+		}
+	}
+
+	args := []string{"fmt", "-w", messy, tidy}
+	var stdout, stderr bytes.Buffer
+	if code := monkey(args, strings.NewReader(""), &stdout,
+		&stderr); code != exitOK {
+		t.Fatalf("monkey %q: exit code is %d, want %d (stderr %q)", args, code,
+			exitOK, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("monkey %q: stdout is %q, want nothing", args, stdout.String())
+	}
+	data, err := os.ReadFile(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != formatted {
+		t.Errorf("monkey %q: file is %q, want %q", args, data, formatted)
+	}
+}
+
+func TestDoc(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lib.mk")
+	src := "// inc adds one to x.\nlet inc = fn(x) { x + 1 };\n"
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"text", "let inc = fn(x)\n    inc adds one to x.\n"},
+		{"markdown", "# lib.mk\n\n## inc\n\n```monkey\nlet inc = fn(x)\n" +
+			"```\n\ninc adds one to x.\n"},
+		{"html", "<h2 id=\"inc\">inc</h2>"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		args := []string{"doc", "-format", tt.format, filename}
+		code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+		if code != exitOK {
+			t.Errorf("monkey %q: exit code is %d, want %d (stderr %q)", args,
+				code, exitOK, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.expected) {
+			t.Errorf("monkey %q: stdout is %q, want it to contain %q", args,
+				stdout.String(), tt.expected)
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := [][]string{
+		{"nosuchcommand"},
+		{"run"},
+		{"run", "a.mk", "b.mk"},
+		{"run", "-engine", "jit", "a.mk"},
+		{"repl", "extra"},
+		{"disasm"},
+		{"build"},
+		{"parse"},
+		{"parse", "-yaml", "a.mk"},
+		{"fmt", "-w"},
+		{"fmt", "-x"},
+		{"doc"},
+		{"doc", "-format", "pdf", "a.mk"},
+	}
+
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		code := monkey(args, strings.NewReader(""), &stdout, &stderr)
+		if code != exitUsage {
+			t.Errorf("monkey %q: exit code is %d, want %d", args, code,
+				exitUsage)
+		}
+		if !strings.Contains(stderr.String(), "usage:") {
+			t.Errorf("monkey %q: stderr is %q, want a usage message", args,
+				stderr.String())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package object // import "github.com/pto/monkey/object"
+
+import (
+	"fmt"
+	"io"
+)
+
+// Builtins lists the builtin functions by name. The order is significant,
+// since compiled code refers to builtins by index.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{"len", &Builtin{Fn: builtinLen}},
+	{"puts", &Builtin{Fn: builtinPuts}},
+	{"first", &Builtin{Fn: builtinFirst}},
+	{"last", &Builtin{Fn: builtinLast}},
+	{"rest", &Builtin{Fn: builtinRest}},
+	{"push", &Builtin{Fn: builtinPush}},
+}
+
+// GetBuiltinByName returns the Builtin called name, or nil if there is none.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// builtinLen returns the number of elements in an array or bytes in a string.
+func builtinLen(_ io.Writer, args ...Object) Object {
+	if len(args) != 1 {
+		return wrongArgumentCount(len(args), 1)
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *String:
+		return &Integer{Value: int64(len(arg.Value))}
+	default:
+		return newError("argument to `len` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// builtinPuts writes each argument to out on a line of its own and returns
+// nil, which is returned to Monkey code as null.
+func builtinPuts(out io.Writer, args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(out, arg.Inspect())
+	}
+	return nil
+}
+
+// builtinFirst returns the first element of an array, or nil if it is empty.
+func builtinFirst(_ io.Writer, args ...Object) Object {
+	arr, err := arrayArgument("first", args)
+	if err != nil {
+		return err
+	}
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+	return nil
+}
+
+// builtinLast returns the last element of an array, or nil if it is empty.
+func builtinLast(_ io.Writer, args ...Object) Object {
+	arr, err := arrayArgument("last", args)
+	if err != nil {
+		return err
+	}
+	if n := len(arr.Elements); n > 0 {
+		return arr.Elements[n-1]
+	}
+	return nil
+}
+
+// builtinRest returns a new array holding all but the first element of an
+// array, or nil if it is empty.
+func builtinRest(_ io.Writer, args ...Object) Object {
+	arr, err := arrayArgument("rest", args)
+	if err != nil {
+		return err
+	}
+	if n := len(arr.Elements); n > 0 {
+		newElements := make([]Object, n-1)
+		copy(newElements, arr.Elements[1:])
+		return &Array{Elements: newElements}
+	}
+	return nil
+}
+
+// builtinPush returns a new array holding the elements of an array followed
+// by a new element. The original array is unchanged.
+func builtinPush(_ io.Writer, args ...Object) Object {
+	if len(args) != 2 {
+		return wrongArgumentCount(len(args), 2)
+	}
+	arr, err := arrayArgument("push", args[:1])
+	if err != nil {
+		return err
+	}
+
+	n := len(arr.Elements)
+	newElements := make([]Object, n+1)
+	copy(newElements, arr.Elements)
+	newElements[n] = args[1]
+	return &Array{Elements: newElements}
+}
+
+// arrayArgument checks that args holds a single array and returns it.
+func arrayArgument(name string, args []Object) (*Array, *Error) {
+	if len(args) != 1 {
+		return nil, wrongArgumentCount(len(args), 1)
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name,
+			args[0].Type())
+	}
+	return arr, nil
+}
+
+// wrongArgumentCount returns an Error for a call with the wrong number of
+// arguments.
+func wrongArgumentCount(got, want int) *Error {
+	return newError("wrong number of arguments: got %d, want %d", got, want)
+}
+
+// newError creates an Error with a formatted message.
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
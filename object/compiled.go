@@ -0,0 +1,45 @@
+package object // import "github.com/pto/monkey/object"
+
+import (
+	"fmt"
+
+	"github.com/pto/monkey/code"
+)
+
+// CompiledFunction is an Object representing the bytecode of a function
+// literal. It is a constant of the compiled program; the virtual machine
+// wraps it in a Closure when the literal is evaluated.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // number of local bindings, including parameters
+	NumParameters int
+	SourceMap     code.SourceMap // may be nil
+}
+
+// Type for a compiled function always returns COMPILED.
+func (cf *CompiledFunction) Type() Type {
+	return COMPILED
+}
+
+// Inspect returns a description of the CompiledFunction that identifies it.
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is an Object representing a function value in the virtual
+// machine: a CompiledFunction together with the values of the free variables
+// it refers to.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Type for a closure always returns CLOSURE.
+func (c *Closure) Type() Type {
+	return CLOSURE
+}
+
+// Inspect returns a description of the Closure that identifies it.
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
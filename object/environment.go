@@ -0,0 +1,75 @@
+package object // import "github.com/pto/monkey/object"
+
+import (
+	"io"
+	"os"
+)
+
+// Environment maps identifiers to their bound values. An Environment may be
+// enclosed by an outer one, whose bindings are visible unless shadowed.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+	out   io.Writer // output of builtins, or nil to use outer's
+	depth int       // number of function calls active
+}
+
+// NewEnvironment creates an empty Environment.
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+// NewEnclosedEnvironment creates an empty Environment enclosed by outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// NewCallEnvironment creates an empty Environment enclosed by outer, for a
+// function called from caller. One more function call is active in it than
+// in caller.
+func NewCallEnvironment(outer, caller *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.depth = caller.depth + 1
+	return env
+}
+
+// Depth returns the number of function calls active in e.
+func (e *Environment) Depth() int {
+	return e.depth
+}
+
+// Get returns the value bound to name in e or the Environments enclosing it,
+// and whether it was found.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// SetOutput sets the writer to which builtins such as puts write when called
+// in e or an Environment enclosed by it.
+func (e *Environment) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// Output returns the writer for builtins called in e: the one set on e or the
+// nearest Environment enclosing it, or else standard output.
+func (e *Environment) Output() io.Writer {
+	for ; e != nil; e = e.outer {
+		if e.out != nil {
+			return e.out
+		}
+	}
+	return os.Stdout
+}
+
+// Set binds name to val in e, shadowing any binding in an enclosing
+// Environment, and returns val.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
@@ -0,0 +1,98 @@
+package object // import "github.com/pto/monkey/object"
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// HashKey is the key under which a Hashable Object is stored in a Hash.
+type HashKey struct {
+	Type  Type
+	Value uint64
+}
+
+// Hashable is implemented by Objects that can be used as Hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+// HashKey returns the key for the Integer.
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// HashKey returns the key for the Boolean.
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+// HashKey returns the key for the String, an FNV-1a hash of its contents.
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// HashPair is a key and value stored in a Hash.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash is an Object representing a map from Hashable keys to values.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+// Type for a hash always returns HASH.
+func (h *Hash) Type() Type {
+	return HASH
+}
+
+// Inspect returns the pairs of the Hash in braces, ordered by key.
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+
+	elements := []string{}
+	for _, pair := range pairs {
+		elements = append(elements,
+			fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// keyLess orders hash keys by type, then by value.
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
@@ -0,0 +1,251 @@
+// Package object defines the runtime values of the Monkey programming
+// language.
+package object // import "github.com/pto/monkey/object"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pto/monkey/ast"
+)
+
+// Type represents the type of a Monkey object.
+type Type string
+
+// Enumeration of Types.
+const (
+	INTEGER     Type = "INTEGER"
+	BOOLEAN     Type = "BOOLEAN"
+	STRING      Type = "STRING"
+	ARRAY       Type = "ARRAY"
+	HASH        Type = "HASH"
+	FUNCTION    Type = "FUNCTION"
+	COMPILED    Type = "COMPILED_FUNCTION"
+	CLOSURE     Type = "CLOSURE"
+	BUILTIN     Type = "BUILTIN"
+	NULL        Type = "NULL"
+	RETURNVALUE Type = "RETURNVALUE"
+	ERROR       Type = "ERROR"
+	QUOTE       Type = "QUOTE"
+	MACRO       Type = "MACRO"
+)
+
+// Object is a Monkey runtime value.
+type Object interface {
+	Type() Type
+	Inspect() string
+}
+
+// Integer is an Object representing a 64-bit signed integer.
+type Integer struct {
+	Value int64
+}
+
+// Type for an integer always returns INTEGER.
+func (i *Integer) Type() Type {
+	return INTEGER
+}
+
+// Inspect returns the decimal representation of the Integer.
+func (i *Integer) Inspect() string {
+	return fmt.Sprintf("%d", i.Value)
+}
+
+// Boolean is an Object representing true or false.
+type Boolean struct {
+	Value bool
+}
+
+// Type for a boolean always returns BOOLEAN.
+func (b *Boolean) Type() Type {
+	return BOOLEAN
+}
+
+// Inspect returns "true" or "false".
+func (b *Boolean) Inspect() string {
+	return fmt.Sprintf("%t", b.Value)
+}
+
+// String is an Object representing a string of characters.
+type String struct {
+	Value string
+}
+
+// Type for a string always returns STRING.
+func (s *String) Type() Type {
+	return STRING
+}
+
+// Inspect returns the contents of the String, without quotes.
+func (s *String) Inspect() string {
+	return s.Value
+}
+
+// Array is an Object representing an ordered list of Objects.
+type Array struct {
+	Elements []Object
+}
+
+// Type for an array always returns ARRAY.
+func (a *Array) Type() Type {
+	return ARRAY
+}
+
+// Inspect returns the elements of the Array in brackets.
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Function is an Object representing a function value: a function literal
+// together with the Environment in which it was evaluated.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type for a function always returns FUNCTION.
+func (f *Function) Type() Type {
+	return FUNCTION
+}
+
+// Inspect returns the source of the Function.
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Quote is an Object carrying an unevaluated AST node, as returned by
+// quote.
+type Quote struct {
+	Node ast.Node
+}
+
+// Type for a quote always returns QUOTE.
+func (q *Quote) Type() Type {
+	return QUOTE
+}
+
+// Inspect returns the source of the quoted node.
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is an Object representing a macro: a macro literal together with
+// the Environment in which it was defined.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type for a macro always returns MACRO.
+func (m *Macro) Type() Type {
+	return MACRO
+}
+
+// Inspect returns the source of the Macro.
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// BuiltinFunction is the Go implementation of a Builtin. Output, as from
+// puts, is written to out.
+type BuiltinFunction func(out io.Writer, args ...Object) Object
+
+// Builtin is an Object representing a function implemented in Go.
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+// Type for a builtin always returns BUILTIN.
+func (b *Builtin) Type() Type {
+	return BUILTIN
+}
+
+// Inspect always returns "builtin function".
+func (b *Builtin) Inspect() string {
+	return "builtin function"
+}
+
+// Null is an Object representing the absence of a value.
+type Null struct{}
+
+// Type for a null always returns NULL.
+func (n *Null) Type() Type {
+	return NULL
+}
+
+// Inspect always returns "null".
+func (n *Null) Inspect() string {
+	return "null"
+}
+
+// ReturnValue is an Object wrapping the value of a return statement while it
+// unwinds to the enclosing function or program.
+type ReturnValue struct {
+	Value Object
+}
+
+// Type for a return value always returns RETURNVALUE.
+func (rv *ReturnValue) Type() Type {
+	return RETURNVALUE
+}
+
+// Inspect returns the description of the wrapped value.
+func (rv *ReturnValue) Inspect() string {
+	return rv.Value.Inspect()
+}
+
+// Error is an Object representing a runtime error.
+type Error struct {
+	Message string
+}
+
+// Type for an error always returns ERROR.
+func (e *Error) Type() Type {
+	return ERROR
+}
+
+// Inspect returns the error message.
+func (e *Error) Inspect() string {
+	return "ERROR: " + e.Message
+}
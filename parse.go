@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/pto/monkey/ast"
+)
+
+// parseCmd implements "monkey parse [-json] file.mk".
+func parseCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "write the syntax tree as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey parse [-json] file.mk\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	filename := flags.Arg(0)
+
+	program, _, ok := parseFile(filename, stderr)
+	if !ok {
+		return exitError
+	}
+
+	var err error
+	if *asJSON {
+		var data []byte
+		if data, err = ast.MarshalJSON(program); err == nil {
+			data = append(data, '\n')
+			_, err = stdout.Write(data)
+		}
+	} else {
+		err = ast.Fprint(stdout, program)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
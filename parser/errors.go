@@ -0,0 +1,161 @@
+package parser // import "github.com/pto/monkey/parser"
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pto/monkey/token"
+)
+
+// ErrorKind classifies a parse error.
+type ErrorKind int
+
+// Enumeration of ErrorKinds.
+const (
+	_                  ErrorKind = iota
+	ErrUnexpectedToken           // a token is not the expected type
+	ErrNoPrefixParseFn           // a token cannot start an expression
+	ErrInvalidInteger            // an integer literal cannot be represented
+	ErrLexical                   // the lexer found a malformed token
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrUnexpectedToken: "unexpected token",
+	ErrNoPrefixParseFn: "no prefix parse function",
+	ErrInvalidInteger:  "invalid integer",
+	ErrLexical:         "lexical error",
+}
+
+// String returns a description of the ErrorKind.
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// Error is a single parse error.
+type Error struct {
+	Pos      token.Position
+	Kind     ErrorKind
+	Expected token.Type // the wanted token type, for ErrUnexpectedToken
+	Got      token.Type // the offending token type
+	Msg      string
+}
+
+// Error returns the position and message of the Error.
+func (e *Error) Error() string {
+	if e.Pos.IsValid() || e.Pos.Filename != "" {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+// ErrorList is a list of parse errors. The zero value is an empty list ready
+// to use.
+type ErrorList []*Error
+
+// Add appends an Error with the given position and message to the list.
+func (p *ErrorList) Add(pos token.Position, kind ErrorKind, msg string) {
+	*p = append(*p, &Error{Pos: pos, Kind: kind, Msg: msg})
+}
+
+// Len, Less and Swap implement sort.Interface.
+func (p ErrorList) Len() int      { return len(p) }
+func (p ErrorList) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p ErrorList) Less(i, j int) bool {
+	e, f := p[i].Pos, p[j].Pos
+	if e.Filename != f.Filename {
+		return e.Filename < f.Filename
+	}
+	return e.Offset < f.Offset
+}
+
+// Sort sorts the list by filename and source position.
+func (p ErrorList) Sort() {
+	sort.Stable(p)
+}
+
+// Error returns the first error in the list and a count of the rest.
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
+// Err returns an error equivalent to the list, or nil if the list is empty.
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// PrintError writes err to w. If err is an ErrorList or an *Error, each error
+// is followed by the offending line of src with a caret under the failing
+// column.
+func PrintError(w io.Writer, src string, err error) {
+	switch err := err.(type) {
+	case ErrorList:
+		for _, e := range err {
+			printError(w, src, e)
+		}
+	case *Error:
+		printError(w, src, err)
+	default:
+		if err != nil {
+			fmt.Fprintf(w, "%s\n", err)
+		}
+	}
+}
+
+// printError writes a single Error and its caret-annotated source line to w.
+func printError(w io.Writer, src string, e *Error) {
+	fmt.Fprintf(w, "%s\n", e)
+
+	line, ok := sourceLine(src, e.Pos)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "\t%s\n", line)
+
+	// Keep tabs so the caret lines up with the source line.
+	n := e.Pos.Offset - lineStart(src, e.Pos.Offset)
+	if n > len(line) {
+		n = len(line)
+	}
+	var caret strings.Builder
+	for _, r := range line[:n] {
+		if r == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	fmt.Fprintf(w, "\t%s^\n", caret.String())
+}
+
+// sourceLine returns the line of src containing pos, without its newline.
+func sourceLine(src string, pos token.Position) (string, bool) {
+	if !pos.IsValid() || pos.Offset < 0 || pos.Offset > len(src) {
+		return "", false
+	}
+	start := lineStart(src, pos.Offset)
+	end := strings.IndexByte(src[start:], '\n')
+	if end < 0 {
+		end = len(src) - start
+	}
+	return strings.TrimSuffix(src[start:start+end], "\r"), true
+}
+
+// lineStart returns the offset of the first byte of the line containing
+// offset.
+func lineStart(src string, offset int) int {
+	return strings.LastIndexByte(src[:offset], '\n') + 1
+}
@@ -0,0 +1,94 @@
+package parser // import "github.com/pto/monkey/parser"
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/token"
+)
+
+func TestErrorList(t *testing.T) {
+	input := "let = 5;\nlet y 6;\n"
+
+	l := lexer.NewFile("bad.mk", input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.ErrorList()
+	if len(errors) < 2 {
+		t.Fatalf("len(errors) is %d, want at least 2: %v", len(errors), errors)
+	}
+
+	first := errors[0]
+	if first.Kind != ErrUnexpectedToken {
+		t.Errorf("first.Kind is %s, want %s", first.Kind, ErrUnexpectedToken)
+	}
+	if first.Expected != token.IDENT {
+		t.Errorf("first.Expected is %s, want %s", first.Expected, token.IDENT)
+	}
+	if first.Got != token.ASSIGN {
+		t.Errorf("first.Got is %s, want %s", first.Got, token.ASSIGN)
+	}
+	if first.Pos.Line != 1 || first.Pos.Column != 5 {
+		t.Errorf("first.Pos is %s, want bad.mk:1:5", first.Pos)
+	}
+	want := "bad.mk:1:5: next token is =, want IDENT"
+	if first.Error() != want {
+		t.Errorf("first.Error() is %q, want %q", first.Error(), want)
+	}
+
+	want = fmt.Sprintf("%s (and %d more errors)", want, len(errors)-1)
+	if errors.Error() != want {
+		t.Errorf("errors.Error() is %q, want %q", errors.Error(), want)
+	}
+
+	strs := p.Errors()
+	if len(strs) != len(errors) {
+		t.Fatalf("len(p.Errors()) is %d, want %d", len(strs), len(errors))
+	}
+	for i, s := range strs {
+		if s != errors[i].Error() {
+			t.Errorf("p.Errors()[%d] is %q, want %q", i, s, errors[i].Error())
+		}
+	}
+}
+
+func TestErrorListErr(t *testing.T) {
+	var errors ErrorList
+	if err := errors.Err(); err != nil {
+		t.Errorf("empty list Err() is %v, want nil", err)
+	}
+
+	errors.Add(token.Position{Line: 2, Column: 1, Offset: 10}, ErrNoPrefixParseFn,
+		"second")
+	errors.Add(token.Position{Line: 1, Column: 1, Offset: 0}, ErrNoPrefixParseFn,
+		"first")
+	errors.Sort()
+	if errors[0].Msg != "first" || errors[1].Msg != "second" {
+		t.Errorf("sorted errors are %q, %q, want \"first\", \"second\"",
+			errors[0].Msg, errors[1].Msg)
+	}
+	if err := errors.Err(); err == nil {
+		t.Errorf("Err() is nil, want an error")
+	}
+}
+
+func TestPrintError(t *testing.T) {
+	input := "let x = 1;\n\tlet y = ;\n"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	var out bytes.Buffer
+	PrintError(&out, input, p.ErrorList().Err())
+
+	want := "2:10: no prefix parse function found for ;\n" +
+		"\t\tlet y = ;\n" +
+		"\t\t        ^\n"
+	if out.String() != want {
+		t.Errorf("PrintError wrote %q, want %q", out.String(), want)
+	}
+}
@@ -2,7 +2,9 @@
 package parser // import "github.com/pto/monkey/parser"
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/pto/monkey/ast"
@@ -15,17 +17,25 @@ type Parser struct {
 	l              *lexer.Lexer
 	curToken       token.Token
 	peekToken      token.Token
-	errors         []string
+	errors         ErrorList
+	panicking      bool // an error was found in the current statement
+	resume         bool // curToken starts the next statement, so keep it
+	depth          int  // brace nesting before curToken
 	prefixParseFns map[token.Type]prefixParseFn
 	infixParseFns  map[token.Type]infixParseFn
+
+	// Comments
+	comments []*ast.CommentGroup // all comment groups read so far
+	curLead  *ast.CommentGroup   // comments on the lines before curToken
+	peekLead *ast.CommentGroup   // comments on the lines before peekToken
+	peekLine *ast.CommentGroup   // comments after curToken on its line
 }
 
 // New initializes a Parser from a Lexer.
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{
-		l:      l,
-		errors: []string{},
-	}
+	p := &Parser{l: l}
+	l.SetErrorHandler(p.lexicalError)
+	l.SetMode(lexer.ScanComments)
 
 	// Set curToken and peekToken
 	p.nextToken()
@@ -35,8 +45,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -47,14 +67,69 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOTEQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	return p
 }
 
 // nextToken advances the Parser by one token.
 func (p *Parser) nextToken() {
-	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		p.depth--
+	}
+	p.curToken, p.curLead = p.peekToken, p.peekLead
+	p.peekToken, p.peekLead, p.peekLine = p.scan(p.curToken)
+}
+
+// scan returns the next token from the Lexer that is not a comment. The
+// comments before it are collected into groups of adjacent lines. A group
+// starting on the line where prev ends, with the token on a later line, is
+// returned as line; the last group, if it ends on the line before the token,
+// is returned as lead.
+func (p *Parser) scan(prev token.Token) (tok token.Token,
+	lead, line *ast.CommentGroup) {
+	tok = p.l.NextToken()
+	if tok.Type != token.COMMENT {
+		return tok, nil, nil
+	}
+
+	if prev.End.IsValid() && tok.Pos.Line == prev.End.Line {
+		group, endLine := p.commentGroup(&tok, 0)
+		if tok.Pos.Line != endLine || tok.Type == token.EOF {
+			line = group
+		}
+	}
+
+	endLine := -1
+	var group *ast.CommentGroup
+	for tok.Type == token.COMMENT {
+		group, endLine = p.commentGroup(&tok, 1)
+	}
+	if endLine+1 == tok.Pos.Line {
+		lead = group
+	}
+	return tok, lead, line
+}
+
+// commentGroup reads the comments starting with tok that begin no more than
+// n lines after the end of the previous one, leaving the token after them in
+// tok. It returns them as a group, with the line on which the group ends.
+func (p *Parser) commentGroup(tok *token.Token, n int) (*ast.CommentGroup,
+	int) {
+	group := &ast.CommentGroup{}
+	endLine := tok.Pos.Line
+	for tok.Type == token.COMMENT && tok.Pos.Line <= endLine+n {
+		group.List = append(group.List,
+			&ast.Comment{Slash: tok.Pos, Text: tok.Literal})
+		endLine = tok.End.Line
+		*tok = p.l.NextToken()
+	}
+	p.comments = append(p.comments, group)
+	return group, endLine
 }
 
 // precendence is a precedence level.
@@ -70,6 +145,7 @@ const (
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 var precedences = map[token.Type]precedence{
@@ -81,6 +157,18 @@ var precedences = map[token.Type]precedence{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+}
+
+// Precedence returns the precedence level of the infix operator t, or LOWEST
+// if t is not an infix operator. Operators with higher levels bind more
+// tightly, and operators at the same level associate to the left.
+func Precedence(t token.Type) int {
+	if p, ok := precedences[t]; ok {
+		return int(p)
+	}
+	return int(LOWEST)
 }
 
 // peekPrecedence returns the precedence of the next token.
@@ -99,7 +187,8 @@ func (p *Parser) curPrecedence() precedence {
 	return LOWEST
 }
 
-// ParseProgram parses an entire Monkey program.
+// ParseProgram parses an entire Monkey program. The Comments of the Program
+// hold every comment in the source.
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -109,23 +198,100 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
-		p.nextToken()
+		p.nextStatement()
 	}
+	program.Comments = p.comments
 
 	return program
 }
 
 // parseStatement returns a Statement of the appropriate type, based on the
-// current token.
+// current token. If the statement has errors, the Parser skips ahead to the
+// next statement boundary and returns whatever part of the statement was
+// parsed, or a BadStatement if none was. The comments on the lines just
+// before the statement and those after it on its last line become its Doc
+// and Comment.
 func (p *Parser) parseStatement() ast.Statement {
+	start, depth, doc := p.curToken, p.depth, p.curLead
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if s := p.parseLetStatement(); s != nil {
+			s.Doc, s.Comment = doc, p.peekLine
+			stmt = s
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		s := p.parseReturnStatement()
+		s.Doc, s.Comment = doc, p.peekLine
+		stmt = s
 	default:
-		return p.parseExpressionStatement()
+		s := p.parseExpressionStatement()
+		s.Doc, s.Comment = doc, p.peekLine
+		stmt = s
+	}
+
+	if p.panicking {
+		p.synchronize(start, depth)
+		p.panicking = false
+		if stmt == nil {
+			stmt = &ast.BadStatement{From: start.Pos, To: p.curToken.End}
+		}
+	}
+	return stmt
+}
+
+// synchronize advances the Parser to the end of a statement that started
+// with start at brace nesting depth: a semicolon, an unmatched right brace,
+// or the token before a right brace or a token that starts a new statement.
+// Braces opened within the statement are skipped until they are closed. If
+// the error was found at a later token that starts a new statement, the
+// Parser stays there, to resume with that statement.
+func (p *Parser) synchronize(start token.Token, depth int) {
+	if p.depth <= depth && p.curToken.Pos != start.Pos {
+		switch p.curToken.Type {
+		case token.LET, token.RETURN:
+			p.resume = true
+			return
+		}
+	}
+
+	for !p.curTokenIs(token.EOF) {
+		if p.depth == depth {
+			switch p.curToken.Type {
+			case token.SEMICOLON:
+				return
+			case token.RBRACE:
+				return // unmatched, so it ends the statement
+			}
+		}
+
+		after := p.depth
+		switch p.curToken.Type {
+		case token.LBRACE:
+			after++
+		case token.RBRACE:
+			after--
+		}
+		if after <= depth {
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.RBRACE, token.EOF:
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
+// nextStatement advances the Parser from the end of a statement to the start
+// of the next one, unless synchronize left it there already.
+func (p *Parser) nextStatement() {
+	if p.resume {
+		p.resume = false
+		return
 	}
+	p.nextToken()
 }
 
 // parseLetStatment returns a LetStatement, starting at the current token.
@@ -140,8 +306,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	// TODO: add expression parsing
-	for !p.curTokenIs(token.SEMICOLON) {
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -153,9 +321,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
+	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	// TODO: add expressing parsing
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -177,13 +345,18 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 // parseExpression returns an Expression, starting at the current token.
+// If the expression has errors, it returns a BadExpression.
 func (p *Parser) parseExpression(precedence precedence) ast.Expression {
+	start := p.curToken
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		return &ast.BadExpression{From: start.Pos, To: p.curToken.End}
 	}
 	exp := prefix()
+	if exp == nil {
+		return &ast.BadExpression{From: start.Pos, To: p.curToken.End}
+	}
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -192,6 +365,9 @@ func (p *Parser) parseExpression(precedence precedence) ast.Expression {
 		}
 		p.nextToken()
 		exp = infix(exp)
+		if p.panicking {
+			return exp
+		}
 	}
 
 	return exp
@@ -210,7 +386,16 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		if errors.Is(err, strconv.ErrRange) {
+			msg = fmt.Sprintf("integer literal %s is out of range "+
+				"[0, %d]", p.curToken.Literal, int64(math.MaxInt64))
+		}
+		p.addError(&Error{
+			Pos:  p.curToken.Pos,
+			Kind: ErrInvalidInteger,
+			Got:  p.curToken.Type,
+			Msg:  msg,
+		})
 		return nil
 	}
 
@@ -218,6 +403,19 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// parseStringLiteral returns a StringLiteral Expression from the current
+// token.
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseIllegal handles an ILLEGAL token. The lexer has already reported the
+// error, so it only puts the Parser into panic mode.
+func (p *Parser) parseIllegal() ast.Expression {
+	p.panicking = true
+	return nil
+}
+
 // parsePrefixExpression returns a PrefixExpression from the current token.
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
@@ -243,6 +441,240 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseBoolean returns a Boolean Expression from the current token.
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+// parseGroupedExpression returns the Expression inside a pair of parentheses,
+// starting at the left parenthesis.
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseIfExpression returns an IfExpression, starting at the current token.
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// parseBlockStatement returns a BlockStatement, starting at the left brace
+// and ending at the matching right brace.
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextStatement()
+	}
+
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken.Pos
+	} else {
+		p.curError(token.RBRACE)
+	}
+
+	return block
+}
+
+// parseFunctionLiteral returns a FunctionLiteral, starting at the current
+// token.
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseMacroLiteral returns a MacroLiteral, starting at the current token.
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseFunctionParameters returns the comma-separated identifiers of a
+// parameter list, starting at the left parenthesis. It returns nil if the
+// list is malformed.
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers,
+		&ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers,
+			&ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+// parseCallExpression returns a CallExpression, starting at the left
+// parenthesis following the function.
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.curToken.Pos
+	}
+	return exp
+}
+
+// parseExpressionList returns the comma-separated expressions of a list,
+// starting at the opening delimiter and ending at end. If the list is not
+// closed, it returns the expressions parsed so far.
+func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	p.expectPeek(end)
+	return list
+}
+
+// parseArrayLiteral returns an ArrayLiteral, starting at the left bracket.
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		array.Rbrack = p.curToken.Pos
+	}
+	return array
+}
+
+// parseHashLiteral returns a HashLiteral, starting at the left brace. A left
+// brace in expression position always starts a hash literal, since blocks
+// only follow the parts of if expressions and function literals.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	hash.Rbrace = p.curToken.Pos
+
+	return hash
+}
+
+// parseIndexExpression returns an IndexExpression, starting at the left
+// bracket following the indexed expression.
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RBRACKET) {
+		return exp
+	}
+	exp.Rbrack = p.curToken.Pos
+
+	return exp
+}
+
 // curTokenIs checks the type of the current token.
 func (p *Parser) curTokenIs(t token.Type) bool {
 	return p.curToken.Type == t
@@ -264,15 +696,59 @@ func (p *Parser) expectPeek(t token.Type) bool {
 	return false
 }
 
-// Errors returns a slice of error strings.
-func (p *Parser) Errors() []string {
+// ErrorList returns the errors found by the Parser, in the order found.
+func (p *Parser) ErrorList() ErrorList {
 	return p.errors
 }
 
+// Errors returns the errors found by the Parser as strings.
+//
+// Deprecated: Use ErrorList, which carries positions and error kinds.
+func (p *Parser) Errors() []string {
+	errors := make([]string, len(p.errors))
+	for i, e := range p.errors {
+		errors[i] = e.Error()
+	}
+	return errors
+}
+
+// lexicalError records an error found by the lexer. Lexical errors are
+// independent of the parse, so they are recorded even in panic mode.
+func (p *Parser) lexicalError(pos token.Position, msg string) {
+	p.errors = append(p.errors, &Error{Pos: pos, Kind: ErrLexical, Msg: msg})
+}
+
+// addError records an Error and puts the Parser into panic mode, so that no
+// further errors are recorded until it reaches the end of the statement.
+func (p *Parser) addError(e *Error) {
+	if p.panicking {
+		return
+	}
+	p.errors = append(p.errors, e)
+	p.panicking = true
+}
+
 // peekError adds an error for when the next token is not the expected type.
 func (p *Parser) peekError(t token.Type) {
-	msg := fmt.Sprintf("next token is %s, want %s", p.peekToken.Type, t)
-	p.errors = append(p.errors, msg)
+	p.addError(&Error{
+		Pos:      p.peekToken.Pos,
+		Kind:     ErrUnexpectedToken,
+		Expected: t,
+		Got:      p.peekToken.Type,
+		Msg:      fmt.Sprintf("next token is %s, want %s", p.peekToken.Type, t),
+	})
+}
+
+// curError adds an error for when the current token is not the expected
+// type.
+func (p *Parser) curError(t token.Type) {
+	p.addError(&Error{
+		Pos:      p.curToken.Pos,
+		Kind:     ErrUnexpectedToken,
+		Expected: t,
+		Got:      p.curToken.Type,
+		Msg:      fmt.Sprintf("token is %s, want %s", p.curToken.Type, t),
+	})
 }
 
 // Types for Pratt Parsing
@@ -293,6 +769,10 @@ func (p *Parser) registerInfix(tokenType token.Type, fn infixParseFn) {
 
 // noPrefixParseFnError adds an error for a missing prefix parse function.
 func (p *Parser) noPrefixParseFnError(t token.Type) {
-	msg := fmt.Sprintf("no prefix parse function found for %s", t)
-	p.errors = append(p.errors, msg)
+	p.addError(&Error{
+		Pos:  p.curToken.Pos,
+		Kind: ErrNoPrefixParseFn,
+		Got:  t,
+		Msg:  fmt.Sprintf("no prefix parse function found for %s", t),
+	})
 }
@@ -2,6 +2,7 @@ package parser // import "github.com/pto/monkey/parser"
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/pto/monkey/ast"
@@ -9,20 +10,51 @@ import (
 )
 
 func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y=10;", "y", 10},
+		{"let foobar = y;", "foobar", "y"},
+		{"let z = 8238383", "z", 8238383},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("len(program.Statements) is %d, want 1",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+
+		val := stmt.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestLetStatementsWithoutSemicolons(t *testing.T) {
 	input := `
-		let x = 5;
-		let y=10;
-		let foobar = 8238383;
-	`
+		let x = 5
+		let y = x + 1
+		let foobar = 8238383`
+
 	l := lexer.New(input)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
-	}
-
 	if len(program.Statements) != 3 {
 		t.Fatalf("len(program.Statements) is %d, want 3",
 			len(program.Statements))
@@ -30,16 +62,37 @@ func TestLetStatements(t *testing.T) {
 
 	tests := []struct {
 		expectedIdentifier string
+		expectedValue      string
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"x", "5"},
+		{"y", "(x + 1)"},
+		{"foobar", "8238383"},
 	}
-	for i, test := range tests {
+	for i, tt := range tests {
 		stmt := program.Statements[i]
-		if !testLetStatement(t, stmt, test.expectedIdentifier) {
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+		val := stmt.(*ast.LetStatement).Value
+		if val.String() != tt.expectedValue {
+			t.Errorf("val.String() is %q, want %q", val.String(),
+				tt.expectedValue)
+		}
+	}
+}
+
+func TestLetStatementAtEOF(t *testing.T) {
+	l := lexer.New("let x =")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("len(errors) is %d, want 1: %v", len(errors), errors)
+	}
+	want := "1:8: no prefix parse function found for EOF"
+	if errors[0] != want {
+		t.Errorf("errors[0] is %q, want %q", errors[0], want)
 	}
 }
 
@@ -65,31 +118,39 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 }
 
 func TestReturnStatements(t *testing.T) {
-	input := `
-		return 5;
-		return 10;
-		return 993322;
-	`
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-
-	if len(program.Statements) != 3 {
-		t.Fatalf("len(program.Statements) is %d, want 3",
-			len(program.Statements))
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return 10", 10},
+		{"return foobar;", "foobar"},
 	}
 
-	for _, stmt := range program.Statements {
-		returnStmt, ok := stmt.(*ast.ReturnStatement)
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("len(program.Statements) is %d, want 1",
+				len(program.Statements))
+		}
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("stmt is %T, want *ast.Statement", stmt)
-			continue
+			t.Fatalf("stmt is %T, want *ast.ReturnStatement",
+				program.Statements[0])
 		}
 		if returnStmt.TokenLiteral() != "return" {
 			t.Errorf("returnStmt.TokenLiteral() is %q, want \"return\"",
 				returnStmt.TokenLiteral())
 		}
+		if !testLiteralExpression(t, returnStmt.ReturnValue,
+			tt.expectedValue) {
+			return
+		}
 	}
 }
 
@@ -157,6 +218,71 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input string
+		value int64
+	}{
+		{"0x1F", 31},
+		{"0o17", 15},
+		{"017", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x7fff_ffff_ffff_ffff", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("expression is %T, want *ast.IntegerLiteral",
+				stmt.Expression)
+		}
+		if literal.Value != tt.value {
+			t.Errorf("%q: literal.Value is %d, want %d", tt.input,
+				literal.Value, tt.value)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() is %q, want %q", literal.String(),
+				tt.input)
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"let x = 99999999999999999999;", "1:9: integer literal " +
+			"99999999999999999999 is out of range [0, 9223372036854775807]"},
+		{"-9223372036854775808", "1:2: integer literal " +
+			"9223372036854775808 is out of range [0, 9223372036854775807]"},
+		{"0x8000_0000_0000_0000", "1:1: integer literal " +
+			"0x8000_0000_0000_0000 is out of range [0, 9223372036854775807]"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.ErrorList()
+		if len(errors) != 1 {
+			t.Errorf("%q: len(errors) is %d, want 1: %v", tt.input,
+				len(errors), p.Errors())
+			continue
+		}
+		if errors[0].Kind != ErrInvalidInteger || errors[0].Error() != tt.want {
+			t.Errorf("%q: error is %q (%s), want %q (%s)", tt.input, errors[0],
+				errors[0].Kind, tt.want, ErrInvalidInteger)
+		}
+	}
+}
+
 func TestParsingPrefixExpression(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -208,7 +334,7 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 		return false
 	}
 	if integ.TokenLiteral() != fmt.Sprintf("%d", value) {
-		t.Errorf("integ.TokenLiteral() is %q, want %q", integ.TokenLiteral(),
+		t.Errorf("integ.TokenLiteral() is %q, want %d", integ.TokenLiteral(),
 			value)
 		return false
 	}
@@ -265,15 +391,873 @@ func TestParsingInfixExpressions(t *testing.T) {
 	}
 }
 
-func checkParserErrors(t *testing.T, p *Parser) {
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("len(program.Statements) is %d, want 1",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("first Statement is %T, want *ast.ExpressionStatement",
+				program.Statements[0])
+		}
+		testBooleanLiteral(t, stmt.Expression, tt.expected)
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello\tworld";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp is %T, want *ast.StringLiteral", stmt.Expression)
+	}
+	if literal.Value != "hello\tworld" {
+		t.Errorf("literal.Value is %q, want %q", literal.Value, "hello\tworld")
+	}
+	if literal.String() != input[:len(input)-1] {
+		t.Errorf("literal.String() is %q, want %q", literal.String(),
+			input[:len(input)-1])
+	}
+}
+
+func TestLexicalErrors(t *testing.T) {
+	input := `let s = "abc
+let t = "a\qb";
+let u = 1 @ 2;
+let v = 3;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	errors := p.ErrorList()
+	want := []string{
+		"1:9: string literal not terminated",
+		"2:11: unknown escape sequence \\q",
+		"3:11: illegal character '@'",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("len(errors) is %d, want %d: %v", len(errors), len(want),
+			p.Errors())
+	}
+	for i, e := range errors {
+		if e.Kind != ErrLexical || e.Error() != want[i] {
+			t.Errorf("errors[%d] is %q (%s), want %q (%s)", i, e, e.Kind,
+				want[i], ErrLexical)
+		}
+	}
+
+	last := program.Statements[len(program.Statements)-1]
+	if last.String() != "let v = 3;" {
+		t.Errorf("last statement is %q, want %q", last, "let v = 3;")
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", "((-a) * b)"},
+		{"!-a", "(!(-a))"},
+		{"a + b + c", "((a + b) + c)"},
+		{"a + b - c", "((a + b) - c)"},
+		{"a * b * c", "((a * b) * c)"},
+		{"a * b / c", "((a * b) / c)"},
+		{"a + b / c", "(a + (b / c))"},
+		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
+		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)"},
+		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
+		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
+		{"3 + 4 * 5 == 3 * 1 + 4 * 5",
+			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"true", "true"},
+		{"false", "false"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"3 < 5 == true", "((3 < 5) == true)"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"2 / (5 + 5)", "(2 / (5 + 5))"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"!(true == true)", "(!(true == true))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))"},
+		{"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a[0]", "(-(a[0]))"},
+		{"f(x)[0]", "(f(x)[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("program.String() is %q, want %q", actual, tt.expected)
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("len(program.Statements) is %d, want 1",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("first Statement is %T, want *ast.ExpressionStatement",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is %T, want *ast.IfExpression",
+			stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("len(exp.Consequence.Statements) is %d, want 1",
+			len(exp.Consequence.Statements))
+	}
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("exp.Consequence.Statements[0] is %T, "+
+			"want *ast.ExpressionStatement", exp.Consequence.Statements[0])
+	}
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative is %+v, want nil", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("len(program.Statements) is %d, want 1",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("first Statement is %T, want *ast.ExpressionStatement",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is %T, want *ast.IfExpression",
+			stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("len(exp.Consequence.Statements) is %d, want 1",
+			len(exp.Consequence.Statements))
+	}
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("exp.Consequence.Statements[0] is %T, "+
+			"want *ast.ExpressionStatement", exp.Consequence.Statements[0])
+	}
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative is %+v, want 1 statement", exp.Alternative)
+	}
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("exp.Alternative.Statements[0] is %T, "+
+			"want *ast.ExpressionStatement", exp.Alternative.Statements[0])
+	}
+	testIdentifier(t, alternative.Expression, "y")
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("len(program.Statements) is %d, want 1",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("first Statement is %T, want *ast.ExpressionStatement",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is %T, want *ast.FunctionLiteral",
+			stmt.Expression)
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("len(function.Parameters) is %d, want 2",
+			len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("len(function.Body.Statements) is %d, want 1",
+			len(function.Body.Statements))
+	}
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body statement is %T, "+
+			"want *ast.ExpressionStatement", function.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("len(program.Statements) is %d, want 1",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("first Statement is %T, want *ast.ExpressionStatement",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is %T, want *ast.MacroLiteral",
+			stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("len(macro.Parameters) is %d, want 2",
+			len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("len(macro.Body.Statements) is %d, want 1",
+			len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body statement is %T, "+
+			"want *ast.ExpressionStatement", macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+	if macro.String() != "macro(x, y) (x + y)" {
+		t.Errorf("macro.String() is %q, want %q", macro.String(),
+			"macro(x, y) (x + y)")
+	}
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) {};", []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("len(function.Parameters) is %d, want %d",
+				len(function.Parameters), len(tt.expectedParams))
+			continue
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("len(program.Statements) is %d, want 1",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("first Statement is %T, want *ast.ExpressionStatement",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is %T, want *ast.CallExpression",
+			stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("len(exp.Arguments) is %d, want 3", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp is %T, want *ast.ArrayLiteral", stmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) is %d, want 3", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+	if end := array.End(); end.Offset != len(input) {
+		t.Errorf("array.End().Offset is %d, want %d", end.Offset, len(input))
+	}
+}
+
+func TestParsingEmptyArrayLiteral(t *testing.T) {
+	l := lexer.New("[]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp is %T, want *ast.ArrayLiteral", stmt.Expression)
+	}
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) is %d, want 0", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp is %T, want *ast.IndexExpression", stmt.Expression)
+	}
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+	if end := indexExp.End(); end.Offset != len(input) {
+		t.Errorf("indexExp.End().Offset is %d, want %d", end.Offset,
+			len(input))
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2, "three": 3}`, `{"one":1, "two":2, "three":3}`},
+		{"{}", "{}"},
+		{"{true: 1, false: 2}", "{true:1, false:2}"},
+		{"{1: 1, 2: 2,}", "{1:1, 2:2}"},
+		{`{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`,
+			`{"one":(0 + 1), "two":(10 - 8), "three":(15 / 5)}`},
+		{"{a: {b: c}}[a][b]", "(({a:{b:c}}[a])[b])"},
+		{"if (x) { {1: 2} } else { {} }", "ifx {1:2}else {}"},
+		{"fn() { {} }", "fn() {}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() is %q, want %q", program.String(),
+				tt.expected)
+		}
+	}
+}
+
+func TestParsingHashLiteralPairs(t *testing.T) {
+	input := `{"one": 1, "two": 2}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is %T, want *ast.HashLiteral", stmt.Expression)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("len(hash.Pairs) is %d, want 2", len(hash.Pairs))
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+	}
+	for i, want := range expected {
+		key, ok := hash.Pairs[i].Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("hash.Pairs[%d].Key is %T, want *ast.StringLiteral", i,
+				hash.Pairs[i].Key)
+			continue
+		}
+		if key.Value != want.key {
+			t.Errorf("hash.Pairs[%d].Key is %q, want %q", i, key.Value,
+				want.key)
+		}
+		testIntegerLiteral(t, hash.Pairs[i].Value, want.value)
+	}
+
+	if end := hash.End(); end.Offset != len(input) {
+		t.Errorf("hash.End().Offset is %d, want %d", end.Offset, len(input))
+	}
+}
+
+func TestParsingHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{1 2}", "1:4: next token is INT, want :"},
+		{"{1: 2 3: 4}", "1:7: next token is INT, want ,"},
+		{"{1: 2", "1:6: next token is EOF, want ,"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("%q: errors are %q, want [%q]", tt.input, errors,
+				tt.expected)
+		}
+	}
+}
+
+func TestUnterminatedBlock(t *testing.T) {
+	l := lexer.New("if (x) { x")
+	p := New(l)
+	p.ParseProgram()
+
 	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("len(errors) is %d, want 1: %v", len(errors), errors)
+	}
+	want := "1:11: token is EOF, want }"
+	if errors[0] != want {
+		t.Errorf("errors[0] is %q, want %q", errors[0], want)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	type wantError struct {
+		line int
+		kind ErrorKind
+	}
+	tests := []struct {
+		input      string
+		wantErrors []wantError
+		want       []string
+	}{
+		{`
+		let = 5;
+		let x = 10;
+		let y 6;
+		if (x { y } else { x };
+		let z = x + y;
+		add(1, 2
+		return z;
+		let w = ;
+		w`,
+			[]wantError{
+				{2, ErrUnexpectedToken},
+				{4, ErrUnexpectedToken},
+				{5, ErrUnexpectedToken},
+				{8, ErrUnexpectedToken}, // unclosed call is found at next token
+				{9, ErrNoPrefixParseFn},
+			},
+			[]string{
+				"<bad statement>",
+				"let x = 10;",
+				"<bad statement>",
+				"<bad expression>",
+				"let z = (x + y);",
+				"add(1, 2)",
+				"return z;",
+				"let w = <bad expression>;",
+				"w",
+			}},
+		{`
+		let a = 1 +
+		let b = [1, 2
+		let c = 3 +
+		let d = (4`,
+			[]wantError{
+				{3, ErrNoPrefixParseFn}, // each error is found at next line
+				{4, ErrUnexpectedToken},
+				{5, ErrNoPrefixParseFn},
+				{5, ErrUnexpectedToken}, // the last at the end of input
+			},
+			[]string{
+				"let a = (1 + <bad expression>);",
+				"let b = [1, 2];",
+				"let c = (3 + <bad expression>);",
+				"let d = <bad expression>;",
+			}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.ErrorList()
+		if len(errors) != len(tt.wantErrors) {
+			t.Errorf("len(errors) is %d, want %d: %v", len(errors),
+				len(tt.wantErrors), p.Errors())
+			continue
+		}
+		for i, want := range tt.wantErrors {
+			if errors[i].Pos.Line != want.line || errors[i].Kind != want.kind {
+				t.Errorf("errors[%d] is %s (%s), want line %d (%s)", i,
+					errors[i], errors[i].Kind, want.line, want.kind)
+			}
+		}
+
+		if len(program.Statements) != len(tt.want) {
+			t.Errorf("len(program.Statements) is %d, want %d: %q",
+				len(program.Statements), len(tt.want), program.String())
+			continue
+		}
+		for i, stmt := range program.Statements {
+			if stmt.String() != tt.want[i] {
+				t.Errorf("program.Statements[%d] is %q, want %q", i,
+					stmt.String(), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestErrorRecoveryInBlock(t *testing.T) {
+	input := `
+		let f = fn(a) {
+			let = a;
+			return a * 2;
+		};
+		}
+		f(1)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	errors := p.ErrorList()
+	if len(errors) != 2 {
+		t.Fatalf("len(errors) is %d, want 2: %v", len(errors), p.Errors())
+	}
+	if errors[0].Pos.Line != 3 || errors[1].Pos.Line != 6 {
+		t.Errorf("errors are on lines %d and %d, want 3 and 6",
+			errors[0].Pos.Line, errors[1].Pos.Line)
+	}
+
+	want := "let f = fn(a) <bad statement>return (a * 2);;" +
+		"<bad expression>f(1)"
+	if program.String() != want {
+		t.Errorf("program.String() is %q, want %q", program.String(), want)
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, -2)`
+
+	l := lexer.NewFile("test.mk", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+	arg := call.(*ast.CallExpression).Arguments[1]
+
+	tests := []struct {
+		node      ast.Node
+		pos, end  string
+		posOffset int
+		endOffset int
+	}{
+		{program, "test.mk:1:1", "test.mk:4:11", 0, 42},
+		{let, "test.mk:1:1", "test.mk:3:2", 0, 30},
+		{let.Name, "test.mk:1:5", "test.mk:1:8", 4, 7},
+		{fn, "test.mk:1:11", "test.mk:3:2", 10, 30},
+		{fn.Body, "test.mk:1:20", "test.mk:3:2", 19, 30},
+		{body, "test.mk:2:3", "test.mk:2:8", 23, 28},
+		{call, "test.mk:4:1", "test.mk:4:11", 32, 42},
+		{arg, "test.mk:4:8", "test.mk:4:10", 39, 41},
+	}
+
+	for _, tt := range tests {
+		pos, end := tt.node.Pos(), tt.node.End()
+		if pos.String() != tt.pos || pos.Offset != tt.posOffset {
+			t.Errorf("%T: Pos() is %s (offset %d), want %s (offset %d)",
+				tt.node, pos, pos.Offset, tt.pos, tt.posOffset)
+		}
+		if end.String() != tt.end || end.Offset != tt.endOffset {
+			t.Errorf("%T: End() is %s (offset %d), want %s (offset %d)",
+				tt.node, end, end.Offset, tt.end, tt.endOffset)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// add returns
+// the sum.
+let add = fn(a, b) { // opening
+	/* result */
+	a /* inline */ + b // sum
+};
+
+// free-floating
+
+return add(1, 2); /* end */
+// last`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	ret := program.Statements[1].(*ast.ReturnStatement)
+
+	text := func(g *ast.CommentGroup) string {
+		if g == nil {
+			return "<nil>"
+		}
+		return g.String()
+	}
+	tests := []struct {
+		name     string
+		group    *ast.CommentGroup
+		expected string
+	}{
+		{"let.Doc", let.Doc, "// add returns\n// the sum."},
+		{"let.Comment", let.Comment, "<nil>"},
+		{"body.Doc", body.Doc, "/* result */"},
+		{"body.Comment", body.Comment, "// sum"},
+		{"ret.Doc", ret.Doc, "<nil>"},
+		{"ret.Comment", ret.Comment, "/* end */"},
+	}
+	for _, tt := range tests {
+		if got := text(tt.group); got != tt.expected {
+			t.Errorf("%s is %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+
+	var all []string
+	for _, g := range program.Comments {
+		all = append(all, g.String())
+	}
+	expected := []string{"// add returns\n// the sum.", "// opening",
+		"/* result */", "/* inline */", "// sum", "// free-floating",
+		"/* end */", "// last"}
+	if !reflect.DeepEqual(all, expected) {
+		t.Errorf("program.Comments are %q, want %q", all, expected)
+	}
+	want := "let add = fn(a, b) (a + b);return add(1, 2);"
+	if got := program.String(); got != want {
+		t.Errorf("program.String() is %q, want %q", got, want)
+	}
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp is %T, want *ast.Identifier", exp)
+		return false
+	}
+	if ident.Value != value {
+		t.Errorf("ident.Value is %q, want %q", ident.Value, value)
+		return false
+	}
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral() is %q, want %q", ident.TokenLiteral(),
+			value)
+		return false
+	}
+	return true
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression,
+	expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled: %T", exp)
+	return false
+}
+
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	b, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp is %T, want *ast.Boolean", exp)
+		return false
+	}
+	if b.Value != value {
+		t.Errorf("b.Value is %t, want %t", b.Value, value)
+		return false
+	}
+	if b.TokenLiteral() != fmt.Sprintf("%t", value) {
+		t.Errorf("b.TokenLiteral() is %q, want %t", b.TokenLiteral(), value)
+		return false
+	}
+	return true
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
+	operator string, right interface{}) bool {
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is %T, want *ast.InfixExpression", exp)
+		return false
+	}
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+	if opExp.Operator != operator {
+		t.Errorf("opExp.Operator is %q, want %q", opExp.Operator, operator)
+		return false
+	}
+	if !testLiteralExpression(t, opExp.Right, right) {
+		return false
+	}
+	return true
+}
+
+func checkParserErrors(t *testing.T, p *Parser) {
+	errors := p.ErrorList()
 	if len(errors) == 0 {
 		return
 	}
 
 	t.Errorf("parser has %d errors", len(errors))
-	for _, msg := range errors {
-		t.Errorf("parser error: %s", msg)
+	for _, err := range errors {
+		t.Errorf("parser error: %s", err)
 	}
 	t.FailNow()
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os/user"
+
+	"github.com/pto/monkey/repl"
+)
+
+// replCmd implements "monkey repl".
+func replCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	modeName := flags.String("mode", string(repl.Eval),
+		"initial `mode`: tokens, ast, sexpr or eval")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey repl [-mode mode]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	mode, err := repl.ParseMode(*modeName)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey repl: %s\n", err)
+		return exitUsage
+	}
+
+	fmt.Fprintf(stdout, "Hello, %s! This is the Monkey programming language.\n",
+		userName())
+	repl.StartMode(stdin, stdout, mode)
+	return exitOK
+}
+
+// userName returns the name of the current user, or a generic greeting if it
+// cannot be found.
+func userName() string {
+	u, err := user.Current()
+	if err != nil {
+		return "there"
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Username
+}
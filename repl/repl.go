@@ -5,30 +5,193 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/evaluator"
 	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/parser"
 	"github.com/pto/monkey/token"
 )
 
 // PROMPT is the REPL command prompt.
 const PROMPT = ">> "
 
-// Start begins a REPL from in to out.
+// CONTINUATION is the prompt for further lines of an incomplete input, such
+// as a function body with an unclosed brace.
+const CONTINUATION = ".. "
+
+// Mode selects what the REPL does with each line of input.
+type Mode string
+
+// Enumeration of Modes.
+const (
+	Tokens Mode = "tokens" // print each token
+	AST    Mode = "ast"    // print the program as an indented tree
+	SExpr  Mode = "sexpr"  // print the program in parenthesized form
+	Eval   Mode = "eval"   // evaluate the program and print the result
+)
+
+// Modes lists the valid Modes.
+var Modes = []Mode{Tokens, AST, SExpr, Eval}
+
+// ParseMode returns the Mode named s.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown mode %q", s)
+}
+
+// Start begins a REPL from in to out, evaluating each line.
 func Start(in io.Reader, out io.Writer) {
+	StartMode(in, out, Eval)
+}
+
+// StartMode begins a REPL from in to out in the given mode. A line starting
+// with a colon is a meta-command: the name of a mode switches to that mode,
+// and ":help" lists the meta-commands. Input with unclosed parentheses or
+// braces, or ending inside a "/* */" comment, continues on the following
+// lines.
+func StartMode(in io.Reader, out io.Writer, mode Mode) {
 	scanner := bufio.NewScanner(in)
+	env := object.NewEnvironment()
+	env.SetOutput(out)
+	macroEnv := object.NewEnvironment()
+	macroEnv.SetOutput(out)
+	var input strings.Builder
 
 	for {
-		fmt.Printf(PROMPT)
+		if input.Len() == 0 {
+			fmt.Fprint(out, PROMPT)
+		} else {
+			fmt.Fprint(out, CONTINUATION)
+		}
 		scanned := scanner.Scan()
 		if !scanned {
+			if input.Len() > 0 {
+				fmt.Fprintln(out)
+				run(out, input.String(), mode, env, macroEnv)
+			}
 			return
 		}
 
 		line := scanner.Text()
-		l := lexer.New(line)
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			mode = metaCommand(out, strings.TrimSpace(line), mode)
+			continue
+		}
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		input.WriteString(line)
+		input.WriteString("\n")
+		if !complete(input.String()) {
+			continue
 		}
+		run(out, input.String(), mode, env, macroEnv)
+		input.Reset()
+	}
+}
+
+// run handles one complete input according to mode. In Eval mode, macros
+// defined in macroEnv are expanded before evaluation in env.
+func run(out io.Writer, src string, mode Mode,
+	env, macroEnv *object.Environment) {
+	if mode == Tokens {
+		printTokens(out, src)
+		return
+	}
+
+	program, ok := parse(out, src)
+	if !ok {
+		return
+	}
+	switch mode {
+	case AST:
+		ast.Fprint(out, program)
+	case SExpr:
+		fmt.Fprintln(out, program.String())
+	case Eval:
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			fmt.Fprintf(out, "macro expansion error: %s\n", err)
+			return
+		}
+		if evaluated := evaluator.Eval(expanded, env); evaluated != nil {
+			fmt.Fprintln(out, evaluated.Inspect())
+		}
+	}
+}
+
+// complete reports whether every parenthesis, brace and bracket in src is
+// closed, and src does not end inside a comment. A string cannot continue on
+// the next line, so one that is not terminated is left for the parser to
+// report.
+func complete(src string) bool {
+	src = strings.TrimSuffix(src, "\n")
+	depth := 0
+	unterminated := false
+	l := lexer.New(src)
+	l.SetErrorHandler(func(pos token.Position, msg string) {
+		unterminated = msg == "comment not terminated"
+	})
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+		if tok.End.Offset < len(src) {
+			unterminated = false // the token was closed by the end of a line
+		}
+	}
+	return depth <= 0 && !unterminated
+}
+
+// metaCommand performs the meta-command cmd and returns the new mode.
+func metaCommand(out io.Writer, cmd string, mode Mode) Mode {
+	name := strings.TrimPrefix(cmd, ":")
+	if m, err := ParseMode(name); err == nil {
+		fmt.Fprintf(out, "mode is %s\n", m)
+		return m
+	}
+
+	switch name {
+	case "mode":
+		fmt.Fprintf(out, "mode is %s\n", mode)
+	case "help":
+		fmt.Fprintln(out, "meta-commands:")
+		for _, m := range Modes {
+			fmt.Fprintf(out, "  :%-8sswitch to %s mode\n", m, m)
+		}
+		fmt.Fprintf(out, "  :%-8sshow the current mode\n", "mode")
+		fmt.Fprintf(out, "  :%-8sshow this help\n", "help")
+	default:
+		fmt.Fprintf(out, "unknown meta-command %s (try :help)\n", cmd)
+	}
+	return mode
+}
+
+// printTokens writes each token in src to out, including comments.
+func printTokens(out io.Writer, src string) {
+	l := lexer.New(src)
+	l.SetMode(lexer.ScanComments)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(out, "%+v\n", tok)
+	}
+}
+
+// parse parses src, writing any errors to out.
+func parse(out io.Writer, src string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		parser.PrintError(out, src, err)
+		return nil, false
 	}
+	return program, true
 }
@@ -0,0 +1,112 @@
+package repl // import "github.com/pto/monkey/repl"
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		mode     Mode
+		input    string
+		expected string
+	}{
+		{Eval, "let x = 2;\nx * 3\n", ">> >> 6\n>> "},
+		{SExpr, "-a * b\n", ">> ((-a) * b)\n>> "},
+		{Eval, "puts(\"hi\")\n", ">> hi\nnull\n>> "},
+		{Tokens, "x!=1\n", ">> {Type:IDENT Literal:x Pos:1:1 End:1:2}\n" +
+			"{Type:!= Literal:!= Pos:1:2 End:1:4}\n" +
+			"{Type:INT Literal:1 Pos:1:4 End:1:5}\n>> "},
+		{AST, "a + 1\n", ">> Program (1:1)\n" +
+			"  Statements:\n" +
+			"    [0] ExpressionStatement (1:1)\n" +
+			"      Expression: InfixExpression Operator=\"+\" (1:1)\n" +
+			"        Left: Identifier Value=\"a\" (1:1)\n" +
+			"        Right: IntegerLiteral Value=1 (1:5)\n>> "},
+		{Eval, "let = 1\n", ">> 1:5: next token is =, want IDENT\n" +
+			"\tlet = 1\n\t    ^\n>> "},
+		{Eval, "let swap = macro(a, b) { quote(unquote(b) - unquote(a)) };\n" +
+			"swap(1, 10)\nswap(1)\n",
+			">> >> 9\n>> macro expansion error: " +
+				"wrong number of arguments: got 1, want 2\n>> "},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		StartMode(strings.NewReader(tt.input), &out, tt.mode)
+		if out.String() != tt.expected {
+			t.Errorf("%s mode, input %q: output is %q, want %q", tt.mode,
+				tt.input, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	input := ":sexpr\n1 + 2\n:eval\n1 + 2\n:mode\n:bogus\n"
+	expected := ">> mode is sexpr\n" +
+		">> (1 + 2)\n" +
+		">> mode is eval\n" +
+		">> 3\n" +
+		">> mode is eval\n" +
+		">> unknown meta-command :bogus (try :help)\n" +
+		">> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if out.String() != expected {
+		t.Errorf("output is %q, want %q", out.String(), expected)
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := "let f = fn(x) {\n  if (x > 1) {\n    x\n  }\n};\n" +
+		"f(5)\n" +
+		"f(\n2\n) + 1\n" +
+		"if (true) {\n"
+	expected := ">> .. .. .. .. let f = fn(x) if(x > 1) x;\n" +
+		">> f(5)\n" +
+		">> .. .. (f(2) + 1)\n" +
+		">> .. \n" +
+		"2:1: token is EOF, want }\n"
+
+	var out bytes.Buffer
+	StartMode(strings.NewReader(input), &out, SExpr)
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("output is %q, want it to start with %q", out.String(),
+			expected)
+	}
+}
+
+func TestUnterminatedInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/* a\ncomment */ 1 + 2\n", ">> .. (1 + 2)\n>> "},
+		{"// a\n1\n", ">> \n>> 1\n>> "},
+		{"x /*\n\n*/\n", ">> .. .. x\n>> "},
+		{"\"abc\n", ">> 1:1: string literal not terminated\n"},
+		{"let s = \"abc\n\";\n2\n",
+			">> 1:9: string literal not terminated\n\tlet s = \"abc\n\t        ^\n" +
+				">> 1:1: string literal not terminated\n\t\";\n\t^\n>> 2\n>> "},
+		{"(\"abc\n)\n", ">> .. 1:2: string literal not terminated\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		StartMode(strings.NewReader(tt.input), &out, SExpr)
+		if !strings.HasPrefix(out.String(), tt.expected) {
+			t.Errorf("input %q: output is %q, want it to start with %q",
+				tt.input, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestOutputGoesToWriter(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(""), &out)
+	if out.String() != PROMPT {
+		t.Errorf("output is %q, want %q", out.String(), PROMPT)
+	}
+}
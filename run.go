@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pto/monkey/ast"
+	"github.com/pto/monkey/compiler"
+	"github.com/pto/monkey/evaluator"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/parser"
+	"github.com/pto/monkey/vm"
+)
+
+// Execution engines.
+const (
+	engineEval = "eval" // tree-walking evaluator
+	engineVM   = "vm"   // bytecode compiler and virtual machine
+)
+
+// runCmd implements "monkey run file.mk", or "monkey run file.mkc" for a
+// compiled file.
+func runCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	engine := flags.String("engine", engineEval,
+		"execution `engine`: eval or vm")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: monkey run [-engine engine] file.mk | file.mkc\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *engine != engineEval && *engine != engineVM {
+		fmt.Fprintf(stderr, "monkey run: unknown engine %q\n", *engine)
+		flags.Usage()
+		return exitUsage
+	}
+	filename := flags.Arg(0)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+
+	var ok bool
+	if compiler.IsCompiled(data) {
+		if *engine != engineVM && engineSet(flags) {
+			fmt.Fprintf(stderr, "monkey run: %s is compiled and can only "+
+				"run on the %s engine\n", filename, engineVM)
+			return exitUsage
+		}
+		ok = runCompiled(filename, data, stdout, stderr)
+	} else {
+		program, parsed := parseSource(filename, string(data), stderr)
+		if !parsed {
+			return exitError
+		}
+		program, parsed = expandMacros(filename, program, stdout, stderr)
+		if !parsed {
+			return exitError
+		}
+		if *engine == engineVM {
+			ok = runVM(filename, program, stdout, stderr)
+		} else {
+			ok = runEval(filename, program, stdout, stderr)
+		}
+	}
+	if !ok {
+		return exitError
+	}
+	return exitOK
+}
+
+// engineSet reports whether the -engine flag was given explicitly.
+func engineSet(flags *flag.FlagSet) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "engine" {
+			set = true
+		}
+	})
+	return set
+}
+
+// runEval executes program with the evaluator, with its output written to
+// stdout. A runtime error is written to stderr, in which case ok is false.
+func runEval(filename string, program *ast.Program,
+	stdout, stderr io.Writer) bool {
+	env := object.NewEnvironment()
+	env.SetOutput(stdout)
+	result := evaluator.Eval(program, env)
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintf(stderr, "%s: runtime error: %s\n", filename, err.Message)
+		return false
+	}
+	return true
+}
+
+// runVM compiles program and executes it with the virtual machine, with its
+// output written to stdout. A compile or runtime error is written to stderr,
+// in which case ok is false.
+func runVM(filename string, program *ast.Program,
+	stdout, stderr io.Writer) bool {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "%s: compile error: %s\n", filename, err)
+		return false
+	}
+
+	return execute(filename, c.Bytecode(), stdout, stderr)
+}
+
+// runCompiled decodes the contents of a compiled file and executes it with
+// the virtual machine, with its output written to stdout. A decoding or
+// runtime error is written to stderr, in which case ok is false.
+func runCompiled(filename string, data []byte, stdout, stderr io.Writer) bool {
+	bytecode, err := compiler.Decode(bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", filename, err)
+		return false
+	}
+	return execute(filename, bytecode, stdout, stderr)
+}
+
+// execute runs bytecode with the virtual machine, with its output written to
+// stdout. A runtime error is written to stderr, in which case ok is false.
+func execute(filename string, bytecode *compiler.Bytecode,
+	stdout, stderr io.Writer) bool {
+	machine := vm.New(bytecode)
+	machine.SetOutput(stdout)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(stderr, "%s: runtime error: %s\n", filename, err)
+		return false
+	}
+	return true
+}
+
+// expandMacros removes the macro definitions from program and expands the
+// calls of those macros. Output from the macros is written to stdout. An
+// error is written to stderr, in which case ok is false.
+func expandMacros(filename string, program *ast.Program,
+	stdout, stderr io.Writer) (*ast.Program, bool) {
+	env := object.NewEnvironment()
+	env.SetOutput(stdout)
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: macro expansion error: %s\n", filename, err)
+		return nil, false
+	}
+	return expanded.(*ast.Program), true
+}
+
+// parseFile reads and parses a Monkey source file, returning the program
+// and its source code. Any errors are written to stderr, in which case ok is
+// false.
+func parseFile(filename string, stderr io.Writer) (*ast.Program, string, bool) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return nil, "", false
+	}
+	src := string(data)
+
+	program, ok := parseSource(filename, src, stderr)
+	return program, src, ok
+}
+
+// parseSource parses the Monkey source code src, read from filename. Any
+// errors are written to stderr, in which case ok is false.
+func parseSource(filename, src string, stderr io.Writer) (*ast.Program, bool) {
+	p := parser.New(lexer.NewFile(filename, src))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		parser.PrintError(stderr, src, err)
+		return nil, false
+	}
+	return program, true
+}
@@ -1,6 +1,8 @@
 // Package token encodes tokens for the Monkey language.
 package token // import "github.com/pto/monkey/token"
 
+import "fmt"
+
 // Type represents the type of a Monkey token.
 type Type string
 
@@ -8,16 +10,53 @@ type Type string
 type Token struct {
 	Type
 	Literal string
+	Pos     Position // position of the first character
+	End     Position // position immediately after the last character
+}
+
+// Position describes a location in Monkey source code.
+type Position struct {
+	Filename string // filename, if any
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1 (character count)
+}
+
+// IsValid reports whether the position has been set.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String returns a description of the Position in one of these forms:
+//
+//	file:line:column    valid position with filename
+//	line:column         valid position without filename
+//	file                invalid position with filename
+//	-                   invalid position without filename
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 // Enumeration of Types.
 const (
 	ILLEGAL Type = "ILLEGAL"
 	EOF     Type = "EOF"
+	COMMENT Type = "COMMENT"
 
 	// Identifiers and literals
-	IDENT Type = "IDENT"
-	INT   Type = "INT"
+	IDENT  Type = "IDENT"
+	INT    Type = "INT"
+	STRING Type = "STRING"
 
 	// Operators
 	ASSIGN   Type = "="
@@ -35,10 +74,13 @@ const (
 	// Delimiters
 	COMMA     Type = ","
 	SEMICOLON Type = ";"
+	COLON     Type = ":"
 	LPAREN    Type = "("
 	RPAREN    Type = ")"
 	LBRACE    Type = "{"
 	RBRACE    Type = "}"
+	LBRACKET  Type = "["
+	RBRACKET  Type = "]"
 
 	// Keywords
 	FUNCTION Type = "FUNCTION"
@@ -48,6 +90,7 @@ const (
 	IF       Type = "IF"
 	ELSE     Type = "ELSE"
 	RETURN   Type = "RETURN"
+	MACRO    Type = "MACRO"
 )
 
 var keywords = map[string]Type{
@@ -58,6 +101,7 @@ var keywords = map[string]Type{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
 }
 
 // LookupIdentifier returns a keyword or IDENT Type for a character string.
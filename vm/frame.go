@@ -0,0 +1,24 @@
+package vm // import "github.com/pto/monkey/vm"
+
+import (
+	"github.com/pto/monkey/code"
+	"github.com/pto/monkey/object"
+)
+
+// Frame is the activation record of a call.
+type Frame struct {
+	cl          *object.Closure
+	ip          int // offset of the current instruction
+	basePointer int // stack pointer before the call, where locals start
+}
+
+// NewFrame creates a Frame for a call of cl with locals starting at
+// basePointer.
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the instructions of the called function.
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,506 @@
+// Package vm implements a stack-based virtual machine that executes the
+// Bytecode produced by the compiler package.
+package vm // import "github.com/pto/monkey/vm"
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pto/monkey/code"
+	"github.com/pto/monkey/compiler"
+	"github.com/pto/monkey/object"
+)
+
+// Limits of the virtual machine.
+const (
+	StackSize   = 2048
+	GlobalsSize = 65536 // number of distinct OpGetGlobal operands
+	MaxFrames   = 1024
+)
+
+// Singleton objects, so that comparisons can use pointer equality.
+var (
+	Null  = &object.Null{}
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+)
+
+// VM executes compiled Monkey programs.
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	stack []object.Object
+	sp    int // next free slot; the top of the stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int // next free frame
+
+	out io.Writer // output of builtins
+}
+
+// New creates a new VM to run bytecode.
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+		out:         os.Stdout,
+	}
+}
+
+// SetOutput sets the writer to which builtins such as puts write. By
+// default, they write to standard output.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+}
+
+// LastPoppedStackElem returns the value most recently popped from the stack:
+// after Run, the value of the last expression statement or of a top-level
+// return statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program. It stops at the first runtime error, which it
+// returns.
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip := vm.currentFrame().ip
+		ins := vm.currentFrame().Instructions()
+		op := code.Opcode(ins[ip])
+
+		var err error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpTrue:
+			err = vm.push(True)
+
+		case code.OpFalse:
+			err = vm.push(False)
+
+		case code.OpNull:
+			err = vm.push(Null)
+
+		case code.OpBang:
+			err = vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+
+		case code.OpMinus:
+			err = vm.executeMinusOperator()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if vm.globals[globalIndex] == nil {
+				return fmt.Errorf("global %d used before it is set", globalIndex)
+			}
+			err = vm.push(vm.globals[globalIndex])
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			local := vm.stack[frame.basePointer+int(localIndex)]
+			if local == nil {
+				return fmt.Errorf("local %d used before it is set", localIndex)
+			}
+			err = vm.push(local)
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(object.Builtins[builtinIndex].Builtin)
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+			err = vm.push(array)
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err == nil {
+				vm.sp -= numElements
+				err = vm.push(hash)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.executeIndexExpression(left, index)
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// A return statement outside a function ends the program.
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(Null)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		default:
+			def, lookupErr := code.Lookup(byte(op))
+			if lookupErr != nil {
+				return lookupErr
+			}
+			return fmt.Errorf("unsupported instruction: %s", def.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// operators maps binary instructions to the operators they implement, for
+// error messages.
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// executeBinaryOperation pops two operands and pushes the result of op.
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	switch {
+	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
+		return vm.executeIntegerOperation(op, left, right)
+	case left.Type() == object.STRING && right.Type() == object.STRING:
+		return vm.executeStringOperation(op, left, right)
+	case left.Type() != right.Type():
+		return fmt.Errorf("type mismatch: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	}
+}
+
+// executeIntegerOperation pushes the result of op on two integers.
+func (vm *VM) executeIntegerOperation(op code.Opcode,
+	left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: leftValue * rightValue})
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(&object.Integer{Value: leftValue / rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	}
+}
+
+// executeStringOperation pushes the result of op on two strings.
+func (vm *VM) executeStringOperation(op code.Opcode,
+	left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftValue + rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), operators[op], right.Type())
+	}
+}
+
+// executeMinusOperator pops an integer and pushes its negation.
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+	if operand.Type() != object.INTEGER {
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+	value := operand.(*object.Integer).Value
+	return vm.push(&object.Integer{Value: -value})
+}
+
+// executeIndexExpression pushes the element of left selected by index.
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return vm.push(Null)
+		}
+		return vm.push(elements[i])
+	case left.Type() == object.HASH:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(pair.Value)
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]",
+			left.Type(), index.Type())
+	}
+}
+
+// buildArray returns an array of the stack elements from start up to end.
+func (vm *VM) buildArray(start, end int) object.Object {
+	elements := make([]object.Object, end-start)
+	copy(elements, vm.stack[start:end])
+	return &object.Array{Elements: elements}
+}
+
+// buildHash returns a hash of the alternating keys and values on the stack
+// from start up to end.
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := start; i < end; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+// executeCall calls the function on the stack below its numArgs arguments.
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// callClosure pushes a Frame for a call of cl. Its arguments become the
+// first locals.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: got %d, want %d",
+			numArgs, cl.Fn.NumParameters)
+	}
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("call stack overflow")
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	// Clear the locals that are not parameters, which may be read before
+	// they are set by a let statement in a branch not taken.
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	return nil
+}
+
+// callBuiltin replaces the builtin and its arguments on the stack with its
+// result. An Error result is returned as a runtime error.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(vm.out, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case nil:
+		return vm.push(Null)
+	case *object.Error:
+		return fmt.Errorf("%s", result.Message)
+	default:
+		return vm.push(result)
+	}
+}
+
+// pushClosure pushes a closure of the compiled function constant at
+// constIndex over the numFree free variables on the stack.
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %s", constant.Type())
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// push pushes o onto the stack.
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+// pop removes and returns the top of the stack. The value stays in its slot
+// for LastPoppedStackElem.
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// currentFrame returns the Frame being executed.
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame starts executing f.
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+// popFrame returns to the caller of the current Frame and returns it.
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// isTruthy reports whether obj counts as true in a condition: anything but
+// false and null.
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null, False:
+		return false
+	default:
+		return true
+	}
+}
+
+// nativeBoolToBooleanObject returns the Boolean singleton for b.
+func nativeBoolToBooleanObject(b bool) object.Object {
+	if b {
+		return True
+	}
+	return False
+}
@@ -0,0 +1,319 @@
+package vm // import "github.com/pto/monkey/vm"
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pto/monkey/compiler"
+	"github.com/pto/monkey/lexer"
+	"github.com/pto/monkey/object"
+	"github.com/pto/monkey/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"[1] == [1]", false},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1) { 10 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 1; }", Null},
+		{"if (true) { }", Null},
+		{"if (true) { if (false) { 1 } else { 2 } }", 2},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let a = fn() { b }; let b = 2; a()", 2},
+		{"let a = 1; let f = fn() { a }; let a = 2; f()", 2},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestStringsArraysAndHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[]", []int{}},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[1, 2, 3][3]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1}[0]", Null},
+		{`{"one": 1, true: 2}[true]`, 2},
+		{"{}[0]", Null},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10; }; f();", 15},
+		{"let f = fn() { return 1; 2 }; f() + 10", 11},
+		{"let f = fn() { }; f()", Null},
+		{"let f = fn() { let x = 1; }; f()", Null},
+		{"let add = fn(a, b) { a + b }; add(5 + 5, add(5, 5))", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let x = 1; let f = fn(x) { x * 10 }; f(2) + x", 21},
+		{`let g = 50;
+		let minusOne = fn() { let num = 1; g - num; };
+		let minusTwo = fn() { let num = 2; g - num; };
+		minusOne() + minusTwo();`, 97},
+		{`let returnsOneReturner = fn() { fn() { 1; } };
+		returnsOneReturner()();`, 1},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{"len([1, 2, 3])", 3},
+		{"first([1, 2, 3])", 1},
+		{"first([])", Null},
+		{"last([1, 2, 3])", 3},
+		{"rest([1, 2, 3])", []int{2, 3}},
+		{"push([], 1)", []int{1}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`let newAdder = fn(a, b) { fn(c) { a + b + c } };
+		let adder = newAdder(1, 2);
+		adder(8);`, 11},
+		{`let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) { let e = d + c; fn(f) { e + f; }; };
+		};
+		newAdderOuter(1, 2)(3)(8);`, 14},
+		{`let compose = fn(f, g) { fn(x) { g(f(x)) } };
+		let inc = fn(x) { x + 1 };
+		let double = fn(x) { x * 2 };
+		compose(inc, double)(5);`, 12},
+		{`let makeCounter = fn(n) { fn() { [n, makeCounter(n + 1)] } };
+		let counter = makeCounter(0);
+		let step = fn(c) { c()[1] };
+		let third = step(step(step(counter)));
+		third()[0] + counter()[0];`, 3},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+		fib(15)`, 610},
+		{`let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) };
+			countDown(1);
+		};
+		wrapper();`, 0},
+		{`let map = fn(arr, f) {
+			let iter = fn(arr, accumulated) {
+				if (len(arr) == 0) {
+					accumulated
+				} else {
+					iter(rest(arr), push(accumulated, f(first(arr))))
+				}
+			};
+			iter(arr, []);
+		};
+		map([1, 2, 3], fn(x) { x * x })`, []int{1, 4, 9}},
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		isEven(10)`, true},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < 2 == 5", "type mismatch: BOOLEAN == INTEGER"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"true < false;", "unknown operator: BOOLEAN < BOOLEAN"},
+		{"1 / 0", "division by zero"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{"1[0]", "index operator not supported: INTEGER[INTEGER]"},
+		{"5(1)", "not a function: INTEGER"},
+		{`{"name": "Monkey"}[[1]];`, "unusable as hash key: ARRAY"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: got 2, want 1"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{"first(1)", "argument to `first` must be ARRAY, got INTEGER"},
+		{"let f = fn() { f() }; f()", "call stack overflow"},
+		{"if (false) { let g = 1 }; g", "global 0 used before it is set"},
+		{"let a = fn() { b }; a(); let b = 2", "global 1 used before it is set"},
+		{"let f = fn(c) { if (c) { let x = 1 }; x }; f(true); f(false)",
+			"local 1 used before it is set"},
+	}
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("%q ran, want error %q", tt.input, tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("error for %q is %q, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	input := `let f = fn(x) { puts(x) }; puts("hello", 1 + 2); f([1, "a"])`
+
+	var out bytes.Buffer
+	vm := New(compile(t, input))
+	vm.SetOutput(&out)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if vm.LastPoppedStackElem() != Null {
+		t.Errorf("result is %v, want null", vm.LastPoppedStackElem())
+	}
+
+	want := "hello\n3\n[1, a]\n"
+	if out.String() != want {
+		t.Errorf("output is %q, want %q", out.String(), want)
+	}
+}
+
+func runVMTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.input, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if err := p.ErrorList().Err(); err != nil {
+		t.Fatalf("%q: parser errors: %v", input, err)
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("%q: compiler error: %s", input, err)
+	}
+	return c.Bytecode()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{},
+	actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("%q: result is %T (%+v), want %d", input, actual, actual,
+				expected)
+		}
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("%q: result is %T (%+v), want %t", input, actual, actual,
+				expected)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("%q: result is %T (%+v), want %q", input, actual, actual,
+				expected)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: result is %T (%+v), want %v", input, actual, actual,
+				expected)
+			return
+		}
+		for i, el := range expected {
+			testExpectedObject(t, input, el, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: result is %T (%+v), want Null", input, actual, actual)
+		}
+	}
+}